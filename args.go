@@ -2,8 +2,61 @@ package main
 
 import (
 	"flag"
+	"time"
 )
 
-var disableDB *bool = flag.Bool("disable_db", false, "Disable database")
+var disableDB *bool = flag.Bool("disable_db", false, "Disable database (same as --store=none --cache=none)")
 var verbose *bool = flag.Bool("verbose", false, "Enable verbose output")
 var exchangeDebug *bool = flag.Bool("debug_exchange", false, "Kill respective go routine after first event on contract")
+
+// Storage
+var storeFlag *string = flag.String("store", "postgres", "Where contracts are stored: postgres, sqlite, memory or none")
+var cacheFlag *string = flag.String("cache", "none", "Cache in front of the store: redis or none")
+var autoMigrate *bool = flag.Bool("migrate", false, "Apply pending schema migrations on start instead of refusing to run")
+var sqlitePath *string = flag.String("sqlite_path", "snipr.db", "Database file used by --store=sqlite")
+
+// Write pipeline
+var queueSize *int = flag.Int("queue_size", 10000, "Maximum number of contracts buffered before listeners are blocked")
+var writeWorkers *int = flag.Int("write_workers", 4, "Number of workers writing contracts to the database")
+var batchSize *int = flag.Int("batch_size", 100, "Maximum number of contracts written per database batch")
+var batchInterval *time.Duration = flag.Duration("batch_interval", 500*time.Millisecond, "Maximum time a partial batch waits before being written")
+var writeRetries *int = flag.Int("write_retries", 5, "Number of attempts for a failed batch before it is given up")
+var metricsAddr *string = flag.String("metrics_addr", "", "Address to serve metrics on (e.g. :9090), disabled when empty")
+
+// Spool
+var spoolDir *string = flag.String("spool_dir", "spool", "Directory for contracts a backend could not accept, disabled when empty")
+var spoolMaxBytes *int64 = flag.Int64("spool_max_bytes", 256<<20, "Maximum size of the spool per backend before new records are dropped")
+var spoolReplayInterval *time.Duration = flag.Duration("spool_replay_interval", 10*time.Second, "How often a spooled backend is retried")
+
+// Enrichment
+var enrich *bool = flag.Bool("enrich", true, "Read ERC-20 name, symbol, decimals and supply of new tokens before storing them")
+var enrichWorkers *int = flag.Int("enrich_workers", 8, "Number of workers completing discovered pools with on-chain reads before they are written")
+var multicallAddress *string = flag.String("multicall_address", multicall3Address, "Multicall3 contract used to batch reads")
+var multicallWindow *time.Duration = flag.Duration("multicall_window", 20*time.Millisecond, "How long reads are collected before a batch is sent")
+var multicallMaxCalls *int = flag.Int("multicall_max_calls", 200, "Maximum number of reads in one batch")
+
+// RPC gateway
+var rpcComputeUnits *float64 = flag.Float64("rpc_cu_per_second", 330, "Compute units per second the provider allows, 0 for no limit")
+var rpcMethodLimits *string = flag.String("rpc_method_limits", "eth_getLogs=10", "Requests per second per method, e.g. eth_getLogs=10,eth_call=50")
+var providerCheckInterval *time.Duration = flag.Duration("provider_check_interval", 10*time.Second, "How often every RPC provider is health checked")
+var providerMaxLatency *time.Duration = flag.Duration("provider_max_latency", 2*time.Second, "Average latency above which a provider is considered unhealthy")
+var providerMaxErrorRate *float64 = flag.Float64("provider_max_error_rate", 0.3, "Error rate (0-1) above which a provider is considered unhealthy")
+var providerMaxLag *uint64 = flag.Uint64("provider_max_lag", 5, "Blocks a provider may fall behind the best one before it is considered unhealthy")
+
+// Ingestion
+var ingest *string = flag.String("ingest", "subscribe", "How factory logs are received: subscribe (log subscription), blocks (new heads, then the logs of each block) or poll (eth_getLogs over HTTP)")
+var pollInterval *time.Duration = flag.Duration("poll_interval", 2*time.Second, "How often the head block is polled with --ingest=poll")
+var pollMaxRange *uint64 = flag.Uint64("poll_max_range", 500, "Maximum number of blocks fetched by one eth_getLogs request with --ingest=poll")
+
+// Chains
+var chainsFlag *string = flag.String("chains", "", "Comma separated chain IDs or names to follow, e.g. 1,base,bsc, each on the providers in NODE_URL_WSS_<id> and NODE_URL_HTTP_<id>. Defaults to the chain of NODE_URL_WSS and NODE_URL_HTTP")
+var backfill *bool = flag.Bool("backfill", false, "With --ingest=poll, start at the block the factories were deployed in instead of the head. Refused on chains where that block is not known")
+
+// Mempool
+var mempool *bool = flag.Bool("mempool", false, "Decode pending pool creations from the mempool (needs a node serving full pending transactions)")
+var pendingTTL *time.Duration = flag.Duration("pending_ttl", 5*time.Minute, "How long a pending pool may stay unmined before it is expired")
+
+// Log quorum and gap checks
+var logQuorum *int = flag.Int("log_quorum", 1, "Subscribe to every factory on this many WebSocket providers and report logs some of them missed")
+var quorumWindow *time.Duration = flag.Duration("quorum_window", 30*time.Second, "How long every quorum provider has to deliver a log before it is reported missing")
+var gapMaxBlocks *uint64 = flag.Uint64("gap_max_blocks", 10000, "Maximum number of blocks checked for missed logs after a reconnect")
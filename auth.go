@@ -1,43 +1,108 @@
 package main
 
 import (
-	"os"
+	"fmt"
 	"log"
-	"context"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 
-	"github.com/ethereum/go-ethereum/ethclient"
+	"snipr/schemas"
 )
 
-func auth() (*ethclient.Client) {
-	wsNodeURL := os.Getenv("NODE_URL_WSS")
-	if wsNodeURL == "" {
-		log.Fatalln("NODE_URL environment variable is not set. This should be your WebSocket endpoint (e.g., wss://...). ")
-	}
+// auth connects to every provider in NODE_URL_WSS and NODE_URL_HTTP (comma
+// separated, in order of preference) and returns a gateway over them.
+func auth() *rpcGateway {
+	return authChain(0)
+}
 
-	httpNodeURL := os.Getenv("NODE_URL_HTTP")
-	if httpNodeURL == "" {
-		log.Println("Warning: NODE_URL_HTTP is not set. Falling back to NODE_URL for RPC calls. This may not work with all node providers.")
-		httpNodeURL = wsNodeURL
+// authChain connects to the providers of one chain, taken from
+// NODE_URL_WSS_<id> and NODE_URL_HTTP_<id> when either is set and from
+// NODE_URL_WSS and NODE_URL_HTTP otherwise. A chainID of 0 accepts whatever
+// chain the providers are on.
+func authChain(chainID uint64) *rpcGateway {
+	wsEnv, httpEnv := "NODE_URL_WSS", "NODE_URL_HTTP"
+	if chainID != 0 {
+		suffix := "_" + strconv.FormatUint(chainID, 10)
+		if os.Getenv(wsEnv+suffix) != "" || os.Getenv(httpEnv+suffix) != "" {
+			wsEnv, httpEnv = wsEnv+suffix, httpEnv+suffix
+		}
 	}
+	wsNodeURLs := os.Getenv(wsEnv)
+	httpNodeURLs := os.Getenv(httpEnv)
 
-	ethClient, err := ethclient.Dial(wsNodeURL)
-	if err != nil {
-		log.Fatalf("Failed to connect to WebSocket endpoint (%s): %v", wsNodeURL, err)
+	if *ingest == "poll" {
+		// polling works over either, only one is needed
+		if wsNodeURLs == "" && httpNodeURLs == "" {
+			log.Fatalf("%s environment variable is not set. This should be your HTTP endpoint(s) (e.g., https://...), comma separated. ", httpEnv)
+		}
+		if httpNodeURLs == "" {
+			log.Printf("Warning: %s is not set. Polling will use the WebSocket endpoints.", httpEnv)
+		}
+	} else {
+		if wsNodeURLs == "" {
+			log.Fatalf("%s environment variable is not set. This should be your WebSocket endpoint(s) (e.g., wss://...), comma separated. ", wsEnv)
+		}
+		if httpNodeURLs == "" {
+			log.Printf("Warning: %s is not set. RPC calls will only use the WebSocket endpoints.", httpEnv)
+		}
 	}
 
-	chainID, err := ethClient.ChainID(context.Background())
+	methodLimits, err := parseRateLimits(*rpcMethodLimits)
 	if err != nil {
-		log.Fatalf("Failed to get chain ID: %v", err)
+		log.Fatalf("Invalid --rpc_method_limits: %v", err)
 	}
-	log.Printf("Chain ID: %s", chainID.String())
 
-	// Failure
+	providers, id, err := loadProviders(wsNodeURLs, httpNodeURLs, *rpcComputeUnits, methodLimits)
 	if err != nil {
-		panic("Error connecting to either / both clients! Check logs")
+		log.Fatalf("Failed to connect to any RPC provider: %v", err)
+	}
+	if chainID != 0 && id.Uint64() != chainID {
+		log.Fatalf("%s and %s are on chain %s, expected chain %d", wsEnv, httpEnv, id, chainID)
 	}
+	log.Printf("Chain ID: %s", id.String())
 
-	// Success
-	log.Println("Connected to WebSocket endpoint: " + wsNodeURL)
+	return newRPCGateway(providers, id)
+}
 
-	return ethClient 
-}
\ No newline at end of file
+// parseChains reads --chains into chain IDs. Names are matched against the
+// chains in schemas.Chains.
+func parseChains(list string) ([]uint64, error) {
+	var ids []uint64
+	seen := make(map[uint64]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		id, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			for _, chain := range schemas.Chains {
+				if strings.EqualFold(chain.Name, name) {
+					id = chain.ID
+				}
+			}
+			if id == 0 {
+				return nil, fmt.Errorf("unknown chain %q", name)
+			}
+		}
+
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// providerName identifies an endpoint in logs and metrics without leaking the
+// API key that is usually part of its path.
+func providerName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Hostname()
+}
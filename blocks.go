@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"snipr/schemas"
+)
+
+// reorgDepth is how many processed blocks are remembered to find where a
+// reorg forked off.
+const reorgDepth = 128
+
+// blockLogsTimeout bounds how long the logs of one block are asked for before
+// the head loop moves on and retries the block later.
+const blockLogsTimeout = 10 * time.Second
+
+var (
+	metricBlocksComplete = expvar.NewInt("blocks_complete")
+	metricBlocksFailed   = expvar.NewInt("blocks_failed")
+	metricBlocksReverted = expvar.NewInt("blocks_reverted")
+	metricReorgs         = expvar.NewInt("reorgs")
+	metricDeepReorgs     = expvar.NewInt("reorgs_deeper_than_remembered")
+	metricLastBlock      = expvar.NewMap("last_complete_block") // by chain
+)
+
+// blockBatch is every factory log of one canonical block, in log order.
+type blockBatch struct {
+	Number     uint64
+	Hash       common.Hash
+	ParentHash common.Hash
+	Time       time.Time
+	ReceivedAt time.Time
+	Logs       []types.Log
+}
+
+type blockRef struct {
+	number uint64
+	hash   common.Hash
+	logs   int
+}
+
+// blockFollower walks the chain one block at a time, strictly in order. Every
+// block's logs are fetched by its hash, so a batch is complete once the
+// request returns, and parent hashes tell when blocks already handed on were
+// reorged out.
+type blockFollower struct {
+	name    string
+	gateway *rpcGateway
+	query   ethereum.FilterQuery
+	handle  func(*blockBatch)
+	reorged func([]blockRef)
+
+	recent []blockRef
+}
+
+func (f *blockFollower) known(hash common.Hash) int {
+	for i := len(f.recent) - 1; i >= 0; i-- {
+		if f.recent[i].hash == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// follow processes every block up to head that was not processed yet. Blocks
+// between the last processed one and head are fetched by parent hash, which
+// also finds the fork point when head is on another branch. It returns false
+// if it stopped at a block it could not fetch, which is fetched again when
+// head is followed again.
+func (f *blockFollower) follow(head *types.Header, receivedAt time.Time) bool {
+	if f.known(head.Hash()) >= 0 {
+		return true
+	}
+
+	branch := []*types.Header{head}
+	fork := -1
+	deep := false
+	for len(f.recent) > 0 {
+		cur := branch[len(branch)-1]
+		if fork = f.known(cur.ParentHash); fork >= 0 {
+			break
+		}
+		if cur.Number.Uint64() <= f.recent[0].number {
+			log.Printf("%s reorged deeper than %d blocks, reverting all of them and starting over at block %d; older reverted blocks are not known", f.name, len(f.recent), cur.Number)
+			deep = true
+			break
+		}
+		if uint64(len(branch)) >= *gapMaxBlocks {
+			log.Printf("%s fell more than %d blocks behind, skipping to block %d", f.name, *gapMaxBlocks, cur.Number)
+			break
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		parent, err := f.gateway.HeaderByHash(ctx, priorityLive, cur.ParentHash)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to fetch block %s on %s: %v", cur.ParentHash.Hex(), f.name, err)
+			return false
+		}
+		branch = append(branch, parent)
+	}
+	slices.Reverse(branch)
+
+	switch {
+	case fork >= 0 && fork+1 < len(f.recent):
+		f.revert(f.recent[fork+1:])
+	case deep:
+		metricDeepReorgs.Add(1)
+		f.revert(f.recent)
+	}
+	f.recent = f.recent[:fork+1]
+
+	for _, h := range branch {
+		// the blocks after it wait, they must be handed on in order
+		if err := f.process(h, receivedAt); err != nil {
+			metricBlocksFailed.Add(1)
+			log.Printf("Failed to fetch logs of block %d (%s) on %s, retrying: %v", h.Number, h.Hash().Hex(), f.name, err)
+			return false
+		}
+	}
+	return true
+}
+
+// revert reports blocks that are no longer canonical, so their contracts are
+// removed before the new branch is handed on. The ones that made it into the
+// new branch arrive again with it.
+func (f *blockFollower) revert(blocks []blockRef) {
+	// the block writer reads them later, recent is appended to meanwhile
+	blocks = slices.Clone(blocks)
+
+	logs := 0
+	for _, b := range blocks {
+		logs += b.logs
+	}
+
+	metricReorgs.Add(1)
+	metricBlocksReverted.Add(int64(len(blocks)))
+	log.Printf("Reorg on %s: blocks %d-%d reverted, %d factory logs were in them",
+		f.name, blocks[0].number, blocks[len(blocks)-1].number, logs)
+
+	f.reorged(blocks)
+}
+
+// process fetches the logs of one block and hands them on as a batch. A block
+// whose logs cannot be fetched within blockLogsTimeout is neither handed on
+// nor remembered.
+func (f *blockFollower) process(h *types.Header, receivedAt time.Time) error {
+	hash := h.Hash()
+	q := f.query
+	q.BlockHash = &hash
+
+	ctx, cancel := context.WithTimeout(context.Background(), blockLogsTimeout)
+	defer cancel()
+
+	var logs []types.Log
+	var err error
+	for attempt := 1; ; attempt++ {
+		logs, err = f.gateway.FilterLogs(ctx, priorityLive, q)
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		// the provider may not have seen the block yet
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(attempt) * 500 * time.Millisecond):
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(logs, func(i, j int) bool { return logs[i].Index < logs[j].Index })
+
+	blockTime := time.Unix(int64(h.Time), 0).UTC()
+	headerTimes.put(hash, blockTime)
+
+	f.handle(&blockBatch{
+		Number:     h.Number.Uint64(),
+		Hash:       hash,
+		ParentHash: h.ParentHash,
+		Time:       blockTime,
+		ReceivedAt: receivedAt,
+		Logs:       logs,
+	})
+
+	f.recent = append(f.recent, blockRef{number: h.Number.Uint64(), hash: hash, logs: len(logs)})
+	if len(f.recent) > reorgDepth {
+		f.recent = f.recent[len(f.recent)-reorgDepth:]
+	}
+	return nil
+}
+
+// blockTicket follows a block, or a reorg, to the write queue. The enricher
+// workers complete the contracts of a block in any order, the block writer
+// waits for the last of them and writes them together.
+type blockTicket struct {
+	batch    *blockBatch // nil for a reorg
+	reverted []blockRef
+
+	pending   sync.WaitGroup
+	mu        sync.Mutex
+	contracts []*schemas.Contract
+	abandoned bool
+}
+
+// done records a completed contract of the block, or nil for one that was
+// dropped.
+func (t *blockTicket) done(c *schemas.Contract) {
+	if c != nil {
+		t.mu.Lock()
+		t.contracts = append(t.contracts, c)
+		t.mu.Unlock()
+	}
+	t.pending.Done()
+}
+
+// abandon marks the block incomplete, one of its contracts never got to be
+// completed.
+func (t *blockTicket) abandon() {
+	t.mu.Lock()
+	t.abandoned = true
+	t.mu.Unlock()
+	t.pending.Done()
+}
+
+// handleBlock hands on the logs of a block in order, followed by the block's
+// ticket so the block writer knows when it is complete.
+func (r *logRouter) handleBlock(b *blockBatch) {
+	t := &blockTicket{batch: b}
+	for _, vLog := range b.Logs {
+		if vLog.Removed {
+			continue
+		}
+		if listener := r.route(vLog); listener != nil {
+			listener.handle(vLog, b.ReceivedAt, t)
+		}
+	}
+	r.blocks.push(t)
+}
+
+// handleReorg has the block writer remove the contracts of blocks a reorg
+// took off the chain.
+func (r *logRouter) handleReorg(blocks []blockRef) {
+	r.blocks.push(&blockTicket{reverted: blocks})
+}
+
+// listenForBlocks follows new heads and fetches the factory logs of every
+// block, instead of subscribing to the logs themselves.
+func listenForBlocks(exchanges []*schemas.Exchange, wg *sync.WaitGroup, gateway *rpcGateway, enricher *enricher) {
+	defer wg.Done()
+
+	router := newLogRouter(exchanges, gateway, enricher)
+	if len(router.routes) == 0 {
+		return
+	}
+
+	name := router.name
+	router.blocks = enricher.queue.blockWriter(name, gateway.ChainID().Uint64())
+	follower := &blockFollower{
+		name:    name,
+		gateway: gateway,
+		query:   router.query,
+		handle:  router.handleBlock,
+		reorged: router.handleReorg,
+	}
+
+	// a head whose blocks could not all be fetched is followed again until
+	// they are, or a newer head arrives
+	var behind *types.Header
+	var retry <-chan time.Time
+
+	// wss reconnection loop
+	for {
+		heads := make(chan *types.Header)
+		changed := gateway.preferredChanged()
+		sub, provider, err := gateway.SubscribeNewHead(context.Background(), priorityLive, heads)
+		if err != nil {
+			log.Printf("Failed to subscribe to new heads on %s: %v. Retrying in 5s...", name, err)
+			time.Sleep(5 * time.Second)
+			continue // resubscribe
+		}
+
+		if *verbose { log.Printf("Subscribed to new heads on %s via %s", name, provider) }
+
+		// blocks missed while disconnected are fetched with the next head
+		func() {
+			defer sub.Unsubscribe()
+			for {
+				select {
+				case err := <-sub.Err():
+					log.Printf("New head subscription dropped for %s on %s: %v. Reconnecting...", name, provider, err)
+					return
+
+				case <-changed:
+					changed = gateway.preferredChanged()
+					if preferred := gateway.preferredName(); preferred != provider {
+						log.Printf("Moving %s new head subscription from %s to %s", name, provider, preferred)
+						return
+					}
+
+				case head := <-heads:
+					behind, retry = nil, nil
+					if !follower.follow(head, time.Now().UTC()) {
+						behind, retry = head, time.After(2*time.Second)
+					}
+
+				case <-retry:
+					retry = nil
+					if !follower.follow(behind, time.Now().UTC()) {
+						retry = time.After(2 * time.Second)
+					} else {
+						behind = nil
+					}
+				}
+			}
+		}()
+
+		// avoid spamming node on reconnect
+		time.Sleep(2 * time.Second)
+	}
+}
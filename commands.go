@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// commands are run as `snipr [flags] <command> [command flags]`. Without a
+// command snipr starts listening.
+var commands = map[string]func(args []string){
+	"contracts": runContracts,
+	"contract":  runContract,
+	"migrate":   runMigrate,
+	"verify":    runVerify,
+	"hooks":     runHooks,
+}
+
+// openReadRepository connects storage for a one-off command.
+func openReadRepository() Repository {
+	store, cache := initDB()
+	repo := readRepository(store, cache)
+	if repo == nil {
+		log.Fatalln("No store or cache enabled, nothing to query.")
+	}
+	return repo
+}
+
+// runContracts prints stored contracts as JSON lines, newest first.
+func runContracts(args []string) {
+	fs := flag.NewFlagSet("contracts", flag.ExitOnError)
+	chainID := fs.Uint64("chain", 0, "Only show contracts from this chain ID")
+	exchange := fs.String("exchange", "", "Only show contracts from this exchange")
+	poolType := fs.String("type", "", "Only show pools of this type, e.g. v2, cl, bin, stable, weighted or launch")
+	token := fs.String("token", "", "Only show pools of this token")
+	launchpad := fs.String("launchpad", "", "Only show tokens launched on this launchpad, with the pools they graduated to")
+	fromBlock := fs.Uint64("from_block", 0, "Only show contracts discovered at or after this block")
+	limit := fs.Int("limit", 50, "Maximum number of contracts to show, 0 for all")
+	fs.Parse(args)
+
+	repo := openReadRepository()
+	defer repo.Close()
+
+	contracts, err := repo.ListContracts(ContractQuery{
+		ChainID:   *chainID,
+		Exchange:  *exchange,
+		PoolType:  *poolType,
+		Token:     *token,
+		FromBlock: *fromBlock,
+		Launchpad: *launchpad,
+		Limit:     *limit,
+	})
+	if err != nil {
+		log.Fatalf("Failed to list contracts: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, c := range contracts {
+		enc.Encode(c)
+	}
+}
+
+// runContract prints a token by address, as stored for the first pool it was
+// listed in, or launched with. `snipr contracts -token` shows its other pools.
+func runContract(args []string) {
+	fs := flag.NewFlagSet("contract", flag.ExitOnError)
+	chainID := fs.Uint64("chain", 0, "Only look the token up on this chain ID")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snipr contract [-chain <id>] <address>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	repo := openReadRepository()
+	defer repo.Close()
+
+	c, err := repo.GetContract(*chainID, fs.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to get contract %s: %v", fs.Arg(0), err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(c)
+}
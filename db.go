@@ -1,85 +1,509 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
-	"fmt"
+	"slices"
 	"time"
 
 	"encoding/json"
 
-	"gorm.io/gorm"
-	"gorm.io/driver/postgres"
+	"github.com/glebarez/sqlite"
 	"github.com/go-redis/redis"
-	
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
 	"snipr/schemas"
 )
 
-var (
-	postgres_db 		*gorm.DB 
-	redis_client    *redis.Client
-)
+var errNotFound = errors.New("contract not found")
+
+// ContractQuery narrows down ListContracts. Zero values match everything.
+type ContractQuery struct {
+	ChainID   uint64
+	Exchange  string
+	PoolType  string
+	Token     string
+	FromBlock uint64
+
+	// Launchpad selects the launches of a launchpad and every pool their
+	// tokens were listed in afterwards
+	Launchpad string
+	Limit     int
+}
+
+// Repository is where discovered contracts are stored and read back from. The
+// write queue, the query commands and anything else that touches stored
+// contracts goes through it, so the backend can be swapped with --store.
+type Repository interface {
+	Name() string
+	SaveContracts(batch []*schemas.Contract) error
+	GetContract(chainID uint64, address string) (*schemas.Contract, error) // the token's first pool, on any chain for 0
+	ListContracts(q ContractQuery) ([]*schemas.Contract, error)
+	Close() error
+}
+
+// BlockReverter is implemented by repositories that can remove the contracts
+// of blocks a reorg took off the chain, so the contracts of the same
+// transactions in the new branch can take their place.
+type BlockReverter interface {
+	RevertBlocks(chainID uint64, blockHashes []string) (int64, error)
+}
+
+// openStore opens the backend selected with --store, or returns nil for none.
+func openStore(kind string) (Repository, error) {
+	switch kind {
+	case "postgres":
+		host := os.Getenv("DB_HOST")
+		port := os.Getenv("DB_PORT")
+		user := os.Getenv("DB_USER")
+		password := os.Getenv("DB_PASS")
+		name := os.Getenv("DB_NAME")
+
+		postgres_dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
+			host, user, password, name, port)
 
-func initDB() {
-	// Postgres connection
-	host := os.Getenv("DB_HOST")  
-	port := os.Getenv("DB_PORT") 
-	user := os.Getenv("DB_USER") 
-	password := os.Getenv("DB_PASS") 
-	name := os.Getenv("DB_NAME") 
+		return openGorm("postgres", postgres.Open(postgres_dsn))
 
-	postgres_dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		host, user, password, name, port)
+	case "sqlite":
+		// WAL lets the query commands read while snipr is writing
+		return openGorm("sqlite", sqlite.Open(*sqlitePath+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"))
+
+	case "memory":
+		return newMemoryRepository(), nil
+
+	case "none", "":
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unknown store %q (expected postgres, sqlite, memory or none)", kind)
+}
+
+// openCache opens the cache selected with --cache, or returns nil for none.
+func openCache(kind string) (Repository, error) {
+	switch kind {
+	case "redis":
+		redis_addr := fmt.Sprintf("%s:%s", os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT"))
+		redis_client := redis.NewClient(&redis.Options{
+			Addr: redis_addr,
+		})
+
+		if _, err := redis_client.Ping().Result(); err != nil {
+			return nil, err
+		}
+
+		return &redisCache{client: redis_client}, nil
+
+	case "none", "":
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unknown cache %q (expected redis or none)", kind)
+}
+
+// initDB connects the store and cache picked on the command line. Either may
+// be nil when disabled.
+func initDB() (store Repository, cache Repository) {
+	storeKind, cacheKind := *storeFlag, *cacheFlag
+	if *disableDB {
+		storeKind, cacheKind = "none", "none"
+	}
 
 	var err error
-	postgres_db, err = gorm.Open(postgres.Open(postgres_dsn), &gorm.Config{})
+	store, err = openStore(storeKind)
 	if err != nil {
 		log.Fatalf("Failed to connect to database!\n %v", err)
 	}
+	if store != nil {
+		checkSchema(store)
+		log.Printf("Connection to %s was successful!", store.Name())
+	} else {
+		log.Println("Database disabled, skipping connection.")
+	}
 
-	err = postgres_db.AutoMigrate(&schemas.Contract{})
+	cache, err = openCache(cacheKind)
 	if err != nil {
-		log.Fatalf("Failed to migrate database!\n %v", err)
+		log.Fatalf("Failed to connect to cache!\n %v", err)
+	}
+	if cache != nil {
+		log.Printf("Connection to %s was successful!", cache.Name())
 	}
 
-	log.Println("Connection to Postgres was successful!")
+	return store, cache
+}
 
-	// Redis connection
-	redis_addr := fmt.Sprintf("%s:%s", os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT"))
-	redis_client = redis.NewClient(&redis.Options{
-			Addr:		 redis_addr,
-	})
+// dbBackends returns the write queue destinations, each with its own spool
+// when --spool_dir is set.
+func dbBackends(repos ...Repository) []*backend {
+	var backends []*backend
+	for _, r := range repos {
+		if r == nil {
+			continue
+		}
+		b := &backend{name: r.Name(), write: r.SaveContracts}
+		if reverter, ok := r.(BlockReverter); ok {
+			b.revert = reverter.RevertBlocks
+		}
+		backends = append(backends, b)
+	}
+
+	if *spoolDir == "" {
+		return backends
+	}
 
-	_, err = redis_client.Ping().Result()
+	for _, b := range backends {
+		// nothing to replay into after a restart
+		if b.name == "memory" {
+			continue
+		}
+
+		sp, err := openSpool(*spoolDir, b.name, *spoolMaxBytes)
+		if err != nil {
+			log.Fatalf("Failed to open spool for %s!\n %v", b.name, err)
+		}
+		b.spool = sp
+	}
+
+	return backends
+}
+
+// gormRepository stores contracts in Postgres or SQLite.
+type gormRepository struct {
+	name string
+	db   *gorm.DB
+}
+
+func openGorm(name string, dialector gorm.Dialector) (*gormRepository, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
-		log.Fatalf("Failed to connect to Redis!\n %v", err)
+		return nil, err
+	}
+
+	if name == "sqlite" {
+		// a single writer avoids SQLITE_BUSY between the write workers
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
 	}
 
-	log.Println("Connection to Redis was successful!")
+	return &gormRepository{name: name, db: db}, nil
 }
 
-func pushNewContract(c *schemas.Contract) {
-	// Push to postgres
-	result := postgres_db.Create(c)
-	if result.Error != nil {
-		log.Printf("Error pushing contract to db: %v", result.Error)
-	} else {
-		if *verbose { log.Printf("Pushed %s to db", c.Address) }
+func (r *gormRepository) Name() string { return r.name }
+
+// SaveContracts inserts a batch in a single statement, and the tokens of its
+// multi-token pools in another. Contracts and tokens that are already stored
+// are skipped rather than failing the whole batch.
+func (r *gormRepository) SaveContracts(batch []*schemas.Contract) error {
+	var tokens []schemas.PoolToken
+	for _, c := range batch {
+		tokens = append(tokens, c.PoolTokens()...)
 	}
 
-	// Push to Redis
-	cacheKey := fmt.Sprintf("%s", c.Address)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(batch).Error; err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tokens).Error
+	})
+}
+
+// loadPoolTokens fills in the Tokens of contracts whose pools have any.
+func (r *gormRepository) loadPoolTokens(contracts []*schemas.Contract) error {
+	byPool := make(map[string][]*schemas.Contract)
+	var pools []string
+	for _, c := range contracts {
+		if c.PoolAddress == "" {
+			continue
+		}
+		key := fmt.Sprintf("%d:%s", c.ChainID, c.PoolAddress)
+		if _, ok := byPool[key]; !ok {
+			pools = append(pools, c.PoolAddress)
+		}
+		byPool[key] = append(byPool[key], c)
+	}
+	if len(pools) == 0 {
+		return nil
+	}
+
+	var tokens []schemas.PoolToken
+	if err := r.db.Where("pool_address IN ?", pools).Order("position").Find(&tokens).Error; err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		for _, c := range byPool[fmt.Sprintf("%d:%s", t.ChainID, t.PoolAddress)] {
+			c.Tokens = append(c.Tokens, t)
+		}
+	}
+	return nil
+}
 
-  json_data, err := json.Marshal(c)
+func (r *gormRepository) GetContract(chainID uint64, address string) (*schemas.Contract, error) {
+	tx := r.db.Where("address = ?", address)
+	if chainID != 0 {
+		tx = tx.Where("chain_id = ?", chainID)
+	}
+
+	var contracts []*schemas.Contract
+	err := tx.Order("block_number, id").Limit(1).Find(&contracts).Error
 	if err != nil {
-			log.Printf("Error marshaling contract %s to JSON: %v", c.Address, err)
-			return
+		return nil, err
+	}
+	if len(contracts) == 0 {
+		return nil, errNotFound
 	}
+	return contracts[0], r.loadPoolTokens(contracts)
+}
 
-	err = redis_client.Set(cacheKey, json_data, 24 * time.Hour).Err()
+func (r *gormRepository) ListContracts(q ContractQuery) ([]*schemas.Contract, error) {
+	tx := r.db.Order("block_number desc")
+	if q.ChainID != 0 {
+		tx = tx.Where("chain_id = ?", q.ChainID)
+	}
+	if q.Exchange != "" {
+		tx = tx.Where("exchange = ?", q.Exchange)
+	}
+	if q.PoolType != "" {
+		tx = tx.Where("pool_type = ?", q.PoolType)
+	}
+	if q.Token != "" {
+		tx = tx.Where("address = ?", q.Token)
+	}
+	if q.Launchpad != "" {
+		launched := r.db.Model(&schemas.Contract{}).Select("chain_id, address").Where("launchpad = ?", q.Launchpad)
+		tx = tx.Where("(chain_id, address) IN (?)", launched)
+	}
+	if q.FromBlock > 0 {
+		tx = tx.Where("block_number >= ?", q.FromBlock)
+	}
+	if q.Limit > 0 {
+		tx = tx.Limit(q.Limit)
+	}
+
+	var contracts []*schemas.Contract
+	if err := tx.Find(&contracts).Error; err != nil {
+		return nil, err
+	}
+	return contracts, r.loadPoolTokens(contracts)
+}
+
+// RevertBlocks deletes the contracts of the blocks and the tokens of their
+// pools.
+func (r *gormRepository) RevertBlocks(chainID uint64, blockHashes []string) (int64, error) {
+	var removed int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		pools := tx.Model(&schemas.Contract{}).Select("chain_id, pool_address").
+			Where("chain_id = ? AND block_hash IN ? AND pool_address <> ''", chainID, blockHashes)
+		if err := tx.Where("(chain_id, pool_address) IN (?)", pools).Delete(&schemas.PoolToken{}).Error; err != nil {
+			return err
+		}
+
+		// soft deleted rows would still hold their (tx hash, log index)
+		res := tx.Unscoped().Where("chain_id = ? AND block_hash IN ?", chainID, blockHashes).Delete(&schemas.Contract{})
+		removed = res.RowsAffected
+		return res.Error
+	})
+	return removed, err
+}
+
+func (r *gormRepository) ListKnownHooks() ([]*schemas.KnownHook, error) {
+	var hooks []*schemas.KnownHook
+	return hooks, r.db.Order("chain_id, address, code_hash").Find(&hooks).Error
+}
+
+// SaveKnownHook inserts h or relabels the hook with the same key.
+func (r *gormRepository) SaveKnownHook(h *schemas.KnownHook) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "address"}, {Name: "code_hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"label", "name", "note", "updated_at"}),
+	}).Create(h).Error
+}
+
+func (r *gormRepository) DeleteKnownHook(chainID uint64, address, codeHash string) error {
+	res := r.db.Where("chain_id = ? AND address = ? AND code_hash = ?", chainID, address, codeHash).Delete(&schemas.KnownHook{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+func (r *gormRepository) Close() error {
+	sqlDB, err := r.db.DB()
 	if err != nil {
-			log.Printf("Error pushing contract %s to Redis: %v", c.Address, err)
-	} else {
-			if *verbose { log.Printf("Pushed %s to Redis", c.Address) }
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// redisCache keeps recently discovered contracts in Redis for a day. It can
+// look contracts up by address but cannot list them.
+type redisCache struct {
+	client *redis.Client
+}
+
+func (r *redisCache) Name() string { return "redis" }
+
+// SaveContracts writes a batch to Redis in one pipelined round trip.
+func (r *redisCache) SaveContracts(batch []*schemas.Contract) error {
+	pipe := r.client.Pipeline()
+	defer pipe.Close()
+
+	for _, c := range batch {
+		json_data, err := json.Marshal(c)
+		if err != nil {
+			log.Printf("Error marshaling contract %s to JSON: %v", c.Address, err)
+			continue
+		}
+
+		// a token listed in several pools keeps its first one on each chain
+		pipe.SetNX(redisContractKey(c.ChainID, c.Address), json_data, 24 * time.Hour)
+
+		// remembered by block so a reorg can take it back
+		if c.BlockHash != "" {
+			key := redisBlockKey(c.ChainID, c.BlockHash)
+			pipe.SAdd(key, c.Address)
+			pipe.Expire(key, 24 * time.Hour)
+		}
+	}
+
+	_, err := pipe.Exec()
+	return err
+}
+
+func redisBlockKey(chainID uint64, blockHash string) string {
+	return fmt.Sprintf("block:%d:%s", chainID, blockHash)
+}
+
+// redisContractKey keys a token by chain, the same address can be a different
+// token on another chain.
+func redisContractKey(chainID uint64, address string) string {
+	return fmt.Sprintf("%d:%s", chainID, address)
+}
+
+// RevertBlocks deletes the cached contracts of the blocks, unless the address
+// is already cached from another block.
+func (r *redisCache) RevertBlocks(chainID uint64, blockHashes []string) (int64, error) {
+	var removed int64
+	for _, hash := range blockHashes {
+		key := redisBlockKey(chainID, hash)
+		addresses, err := r.client.SMembers(key).Result()
+		if err != nil {
+			return removed, err
+		}
+
+		for _, address := range addresses {
+			c, err := r.GetContract(chainID, address)
+			if err == errNotFound {
+				continue
+			}
+			if err != nil {
+				return removed, err
+			}
+			if c.BlockHash != hash {
+				continue
+			}
+			if err := r.client.Del(redisContractKey(chainID, address)).Err(); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+
+		if err := r.client.Del(key).Err(); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// GetContract looks the token up on the chain, or on every known chain in
+// order of their IDs for 0.
+func (r *redisCache) GetContract(chainID uint64, address string) (*schemas.Contract, error) {
+	chainIDs := []uint64{chainID}
+	if chainID == 0 {
+		chainIDs = chainIDs[:0]
+		for id := range schemas.Chains {
+			chainIDs = append(chainIDs, id)
+		}
+		slices.Sort(chainIDs)
+	}
+
+	for _, id := range chainIDs {
+		json_data, err := r.client.Get(redisContractKey(id, address)).Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var c schemas.Contract
+		if err := json.Unmarshal(json_data, &c); err != nil {
+			return nil, err
+		}
+		return &c, nil
+	}
+	return nil, errNotFound
+}
+
+func (r *redisCache) ListContracts(q ContractQuery) ([]*schemas.Contract, error) {
+	return nil, errors.New("redis cache cannot list contracts, use --store")
+}
+
+func (r *redisCache) Close() error { return r.client.Close() }
+
+// cachedRepository reads through the cache before falling back to the store.
+// Writes are not routed through it; the write queue feeds both separately.
+type cachedRepository struct {
+	store Repository
+	cache Repository
+}
+
+func (r *cachedRepository) Name() string { return r.store.Name() + "+" + r.cache.Name() }
+
+func (r *cachedRepository) SaveContracts(batch []*schemas.Contract) error {
+	if err := r.store.SaveContracts(batch); err != nil {
+		return err
+	}
+	return r.cache.SaveContracts(batch)
+}
+
+func (r *cachedRepository) GetContract(chainID uint64, address string) (*schemas.Contract, error) {
+	if c, err := r.cache.GetContract(chainID, address); err == nil {
+		return c, nil
+	}
+	return r.store.GetContract(chainID, address)
+}
+
+func (r *cachedRepository) ListContracts(q ContractQuery) ([]*schemas.Contract, error) {
+	return r.store.ListContracts(q)
+}
+
+func (r *cachedRepository) Close() error {
+	errStore := r.store.Close()
+	errCache := r.cache.Close()
+	return errors.Join(errStore, errCache)
+}
+
+// readRepository combines store and cache for lookups. Returns nil if both
+// are disabled.
+func readRepository(store, cache Repository) Repository {
+	switch {
+	case store != nil && cache != nil:
+		return &cachedRepository{store: store, cache: cache}
+	case store != nil:
+		return store
+	default:
+		return cache
 	}
 }
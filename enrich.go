@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"snipr/schemas"
+)
+
+var (
+	metricEnriched      = expvar.NewInt("tokens_enriched")
+	metricEnrichPartial = expvar.NewInt("tokens_enriched_partial")
+	metricUnresolved    = expvar.NewInt("pools_unresolved")
+)
+
+// discovery is a contract fresh from its factory log, before the calls that
+// complete it.
+type discovery struct {
+	contract   *schemas.Contract
+	listener   *poolListener
+	vLog       types.Log
+	receivedAt time.Time
+	block      *blockTicket // with --ingest=blocks
+}
+
+// finish passes a completed contract on to the write queue, or to its block.
+func (d *discovery) finish(queue *writeQueue) {
+	if d.block != nil {
+		d.block.done(d.contract)
+		return
+	}
+	queue.push(d.contract)
+}
+
+// enricher completes newly discovered contracts with on-chain data before
+// they are written: what the event left out of the pool, the provenance of the
+// event and, with --enrich, the token's metadata. Its workers make the calls
+// so the log routing of a chain is never held up by them. Each contract is
+// read on the chain it was discovered on.
+type enricher struct {
+	calls map[uint64]*callBatcher // by chain ID
+	items chan *discovery
+	quit  chan struct{}
+	wg    sync.WaitGroup
+	queue *writeQueue
+}
+
+func newEnricher(calls map[uint64]*callBatcher, queue *writeQueue, workers int) *enricher {
+	e := &enricher{
+		calls: calls,
+		items: make(chan *discovery, *queueSize),
+		quit:  make(chan struct{}),
+		queue: queue,
+	}
+
+	expvar.Publish("enrich_queue_depth", expvar.Func(func() any { return len(e.items) }))
+
+	for i := 0; i < workers; i++ {
+		e.wg.Add(1)
+		go e.work()
+	}
+
+	return e
+}
+
+// push hands a discovered contract to the workers, blocking while they are
+// behind.
+func (e *enricher) push(d *discovery) {
+	select {
+	case e.items <- d:
+	case <-e.quit:
+		log.Printf("Enricher closed, dropping %s", d.contract.Address)
+		if d.block != nil {
+			d.block.abandon()
+		}
+	}
+}
+
+// close stops the workers after everything queued was enriched and passed on.
+func (e *enricher) close() {
+	close(e.quit)
+	e.wg.Wait()
+}
+
+func (e *enricher) work() {
+	defer e.wg.Done()
+
+	for {
+		select {
+		case d := <-e.items:
+			e.complete(d)
+
+		case <-e.quit:
+			for {
+				select {
+				case d := <-e.items:
+					e.complete(d)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// complete reads what the event of d left out, records where it came from and
+// passes the contract on to the write queue.
+func (e *enricher) complete(d *discovery) {
+	l, c := d.listener, d.contract
+
+	if l.exchange.ReadPool != nil {
+		// a pool the event does not name is useless without its address
+		if err := readPool(e.calls[l.gateway.ChainID().Uint64()], l.exchange, c, d.vLog); err != nil && c.PoolAddress == "" {
+			log.Printf("Dropping %s of %s, its pool could not be found", c.Exchange, c.Address)
+			metricUnresolved.Add(1)
+			if d.block != nil {
+				d.block.done(nil)
+			}
+			return
+		}
+	}
+
+	c.Orient(l.chain)
+	fillProvenance(l.gateway, c, d.vLog, d.receivedAt)
+	verifyPoolAddress(l.exchange, c)
+	pendingPools.confirm(c)
+
+	// flagged before anyone trades, whether or not tokens are enriched
+	if c.Hooks != "" {
+		analyzeHook(l.gateway, c)
+	}
+
+	if *enrich {
+		e.enrich(c)
+	}
+	d.finish(e.queue)
+}
+
+func (e *enricher) enrich(c *schemas.Contract) {
+	calls, ok := e.calls[c.ChainID]
+	if !ok {
+		log.Printf("No RPC providers for chain %d, not enriching %s", c.ChainID, c.Address)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	m := fetchTokenMetadata(ctx, calls, common.HexToAddress(c.Address))
+	c.SetTokenMetadata(m.Name, m.Symbol, m.Decimals, m.DecimalsOK, m.TotalSupply)
+
+	if m.NameOK && m.SymbolOK && m.DecimalsOK && m.TotalSupplyOK {
+		metricEnriched.Add(1)
+	} else {
+		metricEnrichPartial.Add(1)
+	}
+
+	log.Printf("Token %s on %s - %s", c.Address, c.Exchange, c.TokenLabel())
+}
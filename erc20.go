@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ERC-20 view selectors
+var (
+	selectorName        = common.FromHex("0x06fdde03")
+	selectorSymbol      = common.FromHex("0x95d89b41")
+	selectorDecimals    = common.FromHex("0x313ce567")
+	selectorTotalSupply = common.FromHex("0x18160ddd")
+)
+
+// maxTokenString caps names and symbols, some tokens return kilobytes of junk.
+const maxTokenString = 64
+
+// tokenMetadata is what could be read from a token. Fields that reverted or
+// could not be decoded are left at their zero value with ok set to false.
+type tokenMetadata struct {
+	Name        string
+	Symbol      string
+	Decimals    uint8
+	TotalSupply *big.Int
+
+	NameOK, SymbolOK, DecimalsOK, TotalSupplyOK bool
+}
+
+// fetchTokenMetadata reads name, symbol, decimals and totalSupply in one
+// batch. Each call may fail on its own without failing the others.
+func fetchTokenMetadata(ctx context.Context, calls *callBatcher, token common.Address) tokenMetadata {
+	results := calls.CallMany(ctx, []callRequest{
+		{To: token, Data: selectorName},
+		{To: token, Data: selectorSymbol},
+		{To: token, Data: selectorDecimals},
+		{To: token, Data: selectorTotalSupply},
+	})
+
+	// no code or a fallback that returns nothing looks like an empty success
+	ok := func(r callResult) bool { return r.Err == nil && len(r.Data) > 0 }
+
+	var m tokenMetadata
+	if r := results[0]; ok(r) {
+		m.Name, m.NameOK = decodeTokenString(r.Data)
+	}
+	if r := results[1]; ok(r) {
+		m.Symbol, m.SymbolOK = decodeTokenString(r.Data)
+	}
+	if r := results[2]; ok(r) {
+		m.Decimals, m.DecimalsOK = decodeDecimals(r.Data)
+	}
+	if r := results[3]; ok(r) && len(r.Data) >= 32 {
+		m.TotalSupply, m.TotalSupplyOK = new(big.Int).SetBytes(r.Data[:32]), true
+	}
+
+	return m
+}
+
+// decodeTokenString handles both the standard ABI string return and the
+// bytes32 return used by older tokens such as MKR.
+func decodeTokenString(out []byte) (string, bool) {
+	if len(out) == 32 {
+		return cleanTokenString(string(trimZeros(out))), true
+	}
+
+	if len(out) < 64 {
+		return "", false
+	}
+
+	offset := new(big.Int).SetBytes(out[:32])
+	if !offset.IsUint64() || offset.Uint64() > uint64(len(out)-32) {
+		return "", false
+	}
+	start := offset.Uint64()
+
+	length := new(big.Int).SetBytes(out[start : start+32])
+	if !length.IsUint64() || length.Uint64() > uint64(len(out))-start-32 {
+		return "", false
+	}
+
+	data := out[start+32 : start+32+length.Uint64()]
+	return cleanTokenString(string(data)), true
+}
+
+func decodeDecimals(out []byte) (uint8, bool) {
+	if len(out) < 32 {
+		return 0, false
+	}
+
+	d := new(big.Int).SetBytes(out[:32])
+	if !d.IsUint64() || d.Uint64() > 255 {
+		return 0, false
+	}
+	return uint8(d.Uint64()), true
+}
+
+func trimZeros(b []byte) []byte {
+	end := len(b)
+	for end > 0 && b[end-1] == 0 {
+		end--
+	}
+	return b[:end]
+}
+
+// cleanTokenString drops invalid UTF-8 and control characters so a hostile
+// token cannot mess with logs or terminals.
+func cleanTokenString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			continue
+		}
+		if b.Len()+utf8.RuneLen(r) > maxTokenString {
+			break
+		}
+		b.WriteRune(r)
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// word is a 32 byte ABI word holding n.
+func word(n uint64) []byte {
+	return common.LeftPadBytes(new(big.Int).SetUint64(n).Bytes(), 32)
+}
+
+// abiString is s returned as an ABI encoded string.
+func abiString(s string) []byte {
+	out := append(word(32), word(uint64(len(s)))...)
+	return append(out, common.RightPadBytes([]byte(s), (len(s)+31)/32*32)...)
+}
+
+func TestDecodeTokenString(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		out  []byte
+		want string
+		ok   bool
+	}{
+		{"bytes32 like MKR", common.RightPadBytes([]byte("Maker"), 32), "Maker", true},
+		{"ABI string", abiString("Wrapped Ether"), "Wrapped Ether", true},
+		{"ABI string longer than a word", abiString(strings.Repeat("a", 40)), strings.Repeat("a", 40), true},
+		{"empty ABI string", abiString(""), "", true},
+		{"offset out of bounds", append(word(1<<20), word(5)...), "", false},
+		{"offset past the length word", append(word(64), word(5)...), "", false},
+		{"offset over 64 bits", append(common.LeftPadBytes(new(big.Int).Lsh(big.NewInt(1), 200).Bytes(), 32), word(5)...), "", false},
+		{"length out of bounds", append(word(32), word(1000)...), "", false},
+		{"empty output", nil, "", false},
+		{"short output", []byte{0x01, 0x02}, "", false},
+		{"control characters", abiString("Evil\x1b[31mCoin\n"), "Evil[31mCoin", true},
+		{"invalid UTF-8", abiString("Bad\xff\xfeName"), "BadName", true},
+		{"capped", abiString(strings.Repeat("x", 100)), strings.Repeat("x", maxTokenString), true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := decodeTokenString(tt.out)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("got %q, %v, expected %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDecodeDecimals(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		out  []byte
+		want uint8
+		ok   bool
+	}{
+		{"18", word(18), 18, true},
+		{"0", word(0), 0, true},
+		{"255", word(255), 255, true},
+		{"over 255", word(256), 0, false},
+		{"over 64 bits", common.LeftPadBytes(new(big.Int).Lsh(big.NewInt(1), 100).Bytes(), 32), 0, false},
+		{"empty output", nil, 0, false},
+		{"short output", []byte{18}, 0, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := decodeDecimals(tt.out)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("got %d, %v, expected %d, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCleanTokenString(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"  USDC  ", "USDC"},
+		{"a\tb\rc\x00d", "abcd"},
+		{strings.Repeat("é", 40), strings.Repeat("é", maxTokenString/2)},
+		{"", ""},
+	} {
+		if got := cleanTokenString(tt.in); got != tt.want {
+			t.Errorf("cleanTokenString(%q) = %q, expected %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// rpcPriority orders requests waiting for rate limit budget. Lower goes first.
+type rpcPriority int
+
+const (
+	priorityLive rpcPriority = iota
+	priorityBackfill
+	priorityEnrichment
+
+	priorityCount
+)
+
+var priorityNames = [priorityCount]string{"live", "backfill", "enrichment"}
+
+// computeUnits is roughly what providers bill per method. Unknown methods
+// cost defaultComputeUnits.
+var computeUnits = map[string]float64{
+	"eth_blockNumber":           10,
+	"eth_call":                  26,
+	"eth_getCode":               26,
+	"eth_getLogs":               75,
+	"eth_getBlockByHash":        21,
+	"eth_getBlockByNumber":      16,
+	"eth_getTransactionByHash":  17,
+	"eth_getTransactionReceipt": 15,
+	"eth_subscribe":             10,
+}
+
+const defaultComputeUnits = 20
+
+func methodCost(method string) float64 {
+	if cost, ok := computeUnits[method]; ok {
+		return cost
+	}
+	return defaultComputeUnits
+}
+
+var (
+	metricRPCRequests     = expvar.NewMap("rpc_requests")      // by method
+	metricRPCErrors       = expvar.NewMap("rpc_errors")        // by method
+	metricRPCComputeUnits = expvar.NewMap("rpc_compute_units") // by provider
+	metricRPCWaitMillis   = expvar.NewMap("rpc_wait_ms")       // by priority
+)
+
+type rpcTicket struct {
+	provider  *provider
+	method    string
+	cost      float64
+	granted   chan struct{}
+	cancelled bool
+}
+
+// rpcGateway is the one place RPC requests go through. It fails requests over
+// between the configured providers, keeps a compute unit budget per provider
+// and request rates per method, and when budget is short hands it out by
+// priority, so enrichment never delays live ingestion.
+type rpcGateway struct {
+	providers []*provider
+	chainID   *big.Int
+	signer    types.Signer
+
+	mu      sync.Mutex
+	waiting [priorityCount][]*rpcTicket
+	wake    chan struct{}
+
+	prefMu      sync.Mutex
+	preferred   *provider
+	prefChanged chan struct{}
+}
+
+func newRPCGateway(providers []*provider, chainID *big.Int) *rpcGateway {
+	g := &rpcGateway{
+		providers:   providers,
+		chainID:     chainID,
+		signer:      types.LatestSignerForChainID(chainID),
+		wake:        make(chan struct{}, 1),
+		prefChanged: make(chan struct{}),
+	}
+
+	g.updatePreferred()
+	g.publishProviderMetrics()
+
+	go g.dispatch()
+	go g.healthCheck(*providerCheckInterval)
+
+	return g
+}
+
+func (g *rpcGateway) ChainID() *big.Int { return g.chainID }
+
+// acquire blocks until the request may be sent to p or ctx is done.
+func (g *rpcGateway) acquire(ctx context.Context, prio rpcPriority, p *provider, method string, n int) error {
+	t := &rpcTicket{provider: p, method: method, cost: methodCost(method) * float64(n), granted: make(chan struct{})}
+	start := time.Now()
+
+	g.mu.Lock()
+	g.waiting[prio] = append(g.waiting[prio], t)
+	g.mu.Unlock()
+	g.notify()
+
+	select {
+	case <-t.granted:
+		metricRPCWaitMillis.Add(priorityNames[prio], time.Since(start).Milliseconds())
+		return nil
+
+	case <-ctx.Done():
+		g.mu.Lock()
+		t.cancelled = true
+		g.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (g *rpcGateway) notify() {
+	select {
+	case g.wake <- struct{}{}:
+	default:
+	}
+}
+
+// grant lets the first ticket through whose provider has budget for it,
+// highest priority first and in arrival order, dropping cancelled ones on the
+// way. A ticket that has to wait holds up the later ones of its provider, or
+// only those of its method when just the method's rate is short, so lower
+// priorities cannot take the budget it waits for while other providers carry
+// on. Without a ticket to grant it returns how long until the first held up
+// one can go, 0 if none are waiting.
+func (g *rpcGateway) grant(now time.Time) (bool, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	type providerMethod struct {
+		provider *provider
+		method   string
+	}
+	heldProviders := make(map[*provider]bool)
+	heldMethods := make(map[providerMethod]bool)
+	var soonest time.Duration
+
+	for prio := range g.waiting {
+		queue := g.waiting[prio]
+		for i := 0; i < len(queue); i++ {
+			t := queue[i]
+			if t.cancelled {
+				queue = slices.Delete(queue, i, i+1)
+				i--
+				continue
+			}
+
+			p := t.provider
+			if heldProviders[p] || heldMethods[providerMethod{p, t.method}] {
+				continue
+			}
+
+			budgetWait := p.budget.wait(now, t.cost)
+			methodWait := p.methods[t.method].wait(now, 1)
+			if budgetWait == 0 && methodWait == 0 {
+				p.budget.take(t.cost)
+				p.methods[t.method].take(1)
+				g.waiting[prio] = slices.Delete(queue, i, i+1)
+				close(t.granted)
+				return true, 0
+			}
+
+			if budgetWait > 0 {
+				heldProviders[p] = true
+			} else {
+				heldMethods[providerMethod{p, t.method}] = true
+			}
+			if wait := max(budgetWait, methodWait); soonest == 0 || wait < soonest {
+				soonest = wait
+			}
+		}
+		g.waiting[prio] = queue
+	}
+	return false, soonest
+}
+
+func (g *rpcGateway) dispatch() {
+	for {
+		granted, wait := g.grant(time.Now())
+		switch {
+		case granted:
+			continue
+		case wait == 0:
+			<-g.wake
+		default:
+			// a higher priority request may arrive while we wait
+			select {
+			case <-time.After(wait):
+			case <-g.wake:
+			}
+		}
+	}
+}
+
+// do runs fn against the best provider once the gateway lets a request for
+// method through, moving on to the next provider if it fails. n is the number
+// of requests fn sends, for JSON-RPC batches.
+func (g *rpcGateway) do(ctx context.Context, prio rpcPriority, method string, n int, needWS bool, fn func(p *provider, client *ethclient.Client) error) error {
+	err := errNoProvider
+	for _, p := range g.candidates(needWS) {
+		err = g.doOn(ctx, prio, p, method, n, fn)
+		if !providerFailed(err) || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("%s failed on %s, trying next provider: %v", method, p.name, err)
+	}
+	return err
+}
+
+// doOn runs fn against one provider once the gateway lets a request for method
+// through and records how it went.
+func (g *rpcGateway) doOn(ctx context.Context, prio rpcPriority, p *provider, method string, n int, fn func(p *provider, client *ethclient.Client) error) error {
+	client := p.getClient()
+	if client == nil {
+		return errNoProvider
+	}
+
+	if err := g.acquire(ctx, prio, p, method, n); err != nil {
+		return err
+	}
+
+	metricRPCRequests.Add(method, int64(n))
+	metricRPCComputeUnits.Add(p.name, int64(methodCost(method))*int64(n))
+
+	start := time.Now()
+	err := fn(p, client)
+	if providerFailed(err) {
+		p.observe(time.Since(start), err)
+		metricRPCErrors.Add(method, 1)
+	} else {
+		p.observe(time.Since(start), nil)
+	}
+
+	return err
+}
+
+func (g *rpcGateway) CallContract(ctx context.Context, prio rpcPriority, msg ethereum.CallMsg, block *big.Int) (out []byte, err error) {
+	err = g.do(ctx, prio, "eth_call", 1, false, func(p *provider, c *ethclient.Client) error {
+		out, err = c.CallContract(ctx, msg, block)
+		return err
+	})
+	return out, err
+}
+
+func (g *rpcGateway) CodeAt(ctx context.Context, prio rpcPriority, account common.Address, block *big.Int) (code []byte, err error) {
+	err = g.do(ctx, prio, "eth_getCode", 1, false, func(p *provider, c *ethclient.Client) error {
+		code, err = c.CodeAt(ctx, account, block)
+		return err
+	})
+	return code, err
+}
+
+func (g *rpcGateway) HeaderByHash(ctx context.Context, prio rpcPriority, hash common.Hash) (header *types.Header, err error) {
+	err = g.do(ctx, prio, "eth_getBlockByHash", 1, false, func(p *provider, c *ethclient.Client) error {
+		header, err = c.HeaderByHash(ctx, hash)
+		return err
+	})
+	return header, err
+}
+
+// TransactionFrom returns the sender of a transaction as the node reports it.
+// Only the from field is decoded, so transactions go-ethereum cannot decode or
+// recover the sender of, like OP stack deposits, still have one.
+func (g *rpcGateway) TransactionFrom(ctx context.Context, prio rpcPriority, hash common.Hash) (from common.Address, err error) {
+	err = g.do(ctx, prio, "eth_getTransactionByHash", 1, false, func(p *provider, c *ethclient.Client) error {
+		var tx *struct {
+			From common.Address `json:"from"`
+		}
+		if err := c.Client().CallContext(ctx, &tx, "eth_getTransactionByHash", hash); err != nil {
+			return err
+		}
+		if tx == nil {
+			return ethereum.NotFound
+		}
+		from = tx.From
+		return nil
+	})
+	return from, err
+}
+
+func (g *rpcGateway) TransactionReceipt(ctx context.Context, prio rpcPriority, hash common.Hash) (receipt *types.Receipt, err error) {
+	err = g.do(ctx, prio, "eth_getTransactionReceipt", 1, false, func(p *provider, c *ethclient.Client) error {
+		receipt, err = c.TransactionReceipt(ctx, hash)
+		return err
+	})
+	return receipt, err
+}
+
+// TransactionSender recovers the sender of a pending transaction locally, no
+// request is sent.
+func (g *rpcGateway) TransactionSender(tx *types.Transaction) (common.Address, error) {
+	return types.Sender(g.signer, tx)
+}
+
+// BatchCall sends elems as one JSON-RPC batch, charged per element as method.
+func (g *rpcGateway) BatchCall(ctx context.Context, prio rpcPriority, method string, elems []rpc.BatchElem) error {
+	return g.do(ctx, prio, method, len(elems), false, func(p *provider, c *ethclient.Client) error {
+		return c.Client().BatchCallContext(ctx, elems)
+	})
+}
+
+// SubscribeFilterLogs subscribes on the preferred WebSocket provider and
+// returns its name. Callers should resubscribe when preferredChanged fires.
+func (g *rpcGateway) SubscribeFilterLogs(ctx context.Context, prio rpcPriority, q ethereum.FilterQuery, ch chan<- types.Log) (sub ethereum.Subscription, name string, err error) {
+	err = g.do(ctx, prio, "eth_subscribe", 1, true, func(p *provider, c *ethclient.Client) error {
+		sub, err = c.SubscribeFilterLogs(ctx, q, ch)
+		name = p.name
+		return err
+	})
+	return sub, name, err
+}
+
+// SubscribeFilterLogsOn subscribes on a specific provider, for callers that
+// need more than one subscription at a time.
+func (g *rpcGateway) SubscribeFilterLogsOn(ctx context.Context, prio rpcPriority, p *provider, q ethereum.FilterQuery, ch chan<- types.Log) (sub ethereum.Subscription, err error) {
+	err = g.doOn(ctx, prio, p, "eth_subscribe", 1, func(p *provider, c *ethclient.Client) error {
+		sub, err = c.SubscribeFilterLogs(ctx, q, ch)
+		return err
+	})
+	return sub, err
+}
+
+// SubscribeNewHead subscribes to new heads on the preferred WebSocket provider
+// and returns its name, like SubscribeFilterLogs.
+func (g *rpcGateway) SubscribeNewHead(ctx context.Context, prio rpcPriority, ch chan<- *types.Header) (sub ethereum.Subscription, name string, err error) {
+	err = g.do(ctx, prio, "eth_subscribe", 1, true, func(p *provider, c *ethclient.Client) error {
+		sub, err = c.SubscribeNewHead(ctx, ch)
+		name = p.name
+		return err
+	})
+	return sub, name, err
+}
+
+// SubscribePendingTransactions subscribes to full pending transactions on the
+// preferred WebSocket provider. Only nodes that support the full transaction
+// variant of newPendingTransactions (geth and most geth forks) can serve it.
+func (g *rpcGateway) SubscribePendingTransactions(ctx context.Context, prio rpcPriority, ch chan<- *types.Transaction) (sub ethereum.Subscription, name string, err error) {
+	err = g.do(ctx, prio, "eth_subscribe", 1, true, func(p *provider, c *ethclient.Client) error {
+		sub, err = c.Client().EthSubscribe(ctx, ch, "newPendingTransactions", true)
+		name = p.name
+		return err
+	})
+	return sub, name, err
+}
+
+func (g *rpcGateway) FilterLogs(ctx context.Context, prio rpcPriority, q ethereum.FilterQuery) (logs []types.Log, err error) {
+	err = g.do(ctx, prio, "eth_getLogs", 1, false, func(p *provider, c *ethclient.Client) error {
+		logs, err = c.FilterLogs(ctx, q)
+		return err
+	})
+	return logs, err
+}
+
+func (g *rpcGateway) FilterLogsOn(ctx context.Context, prio rpcPriority, p *provider, q ethereum.FilterQuery) (logs []types.Log, err error) {
+	err = g.doOn(ctx, prio, p, "eth_getLogs", 1, func(p *provider, c *ethclient.Client) error {
+		logs, err = c.FilterLogs(ctx, q)
+		return err
+	})
+	return logs, err
+}
+
+func (g *rpcGateway) BlockNumber(ctx context.Context, prio rpcPriority) (head uint64, err error) {
+	err = g.do(ctx, prio, "eth_blockNumber", 1, false, func(p *provider, c *ethclient.Client) error {
+		head, err = c.BlockNumber(ctx)
+		return err
+	})
+	return head, err
+}
+
+func (g *rpcGateway) BlockNumberOn(ctx context.Context, prio rpcPriority, p *provider) (head uint64, err error) {
+	err = g.doOn(ctx, prio, p, "eth_blockNumber", 1, func(p *provider, c *ethclient.Client) error {
+		head, err = c.BlockNumber(ctx)
+		return err
+	})
+	return head, err
+}
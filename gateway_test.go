@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func granted(t *rpcTicket) bool {
+	select {
+	case <-t.granted:
+		return true
+	default:
+		return false
+	}
+}
+
+// TestGrantPerProvider checks that a ticket waiting for its provider's budget
+// holds up only that provider.
+func TestGrantPerProvider(t *testing.T) {
+	now := time.Now()
+	a := newProvider(0, "http://a.invalid", 10, nil)
+	b := newProvider(1, "http://b.invalid", 10, nil)
+	a.budget.take(10)
+	a.budget.last, b.budget.last = now, now
+
+	g := &rpcGateway{wake: make(chan struct{}, 1)}
+	ticket := func(prio rpcPriority, p *provider, method string) *rpcTicket {
+		tk := &rpcTicket{provider: p, method: method, cost: methodCost(method), granted: make(chan struct{})}
+		g.waiting[prio] = append(g.waiting[prio], tk)
+		return tk
+	}
+
+	liveOnA := ticket(priorityLive, a, "eth_blockNumber")
+	enrichmentOnA := ticket(priorityEnrichment, a, "eth_call")
+	enrichmentOnB := ticket(priorityEnrichment, b, "eth_call")
+
+	if ok, _ := g.grant(now); !ok || !granted(enrichmentOnB) {
+		t.Fatal("a ticket for a provider with budget waited behind another provider")
+	}
+	ok, wait := g.grant(now)
+	if ok || granted(liveOnA) || granted(enrichmentOnA) {
+		t.Fatal("a ticket was granted without budget")
+	}
+	if wait <= 0 {
+		t.Errorf("waits %v for the budget of a", wait)
+	}
+
+	// once a has budget again its live ticket goes first
+	later := now.Add(time.Second)
+	if ok, _ := g.grant(later); !ok || !granted(liveOnA) || granted(enrichmentOnA) {
+		t.Error("the live ticket of a did not go first")
+	}
+}
+
+// TestGrantPerMethod checks that a method over its rate holds up only that
+// method on its provider.
+func TestGrantPerMethod(t *testing.T) {
+	now := time.Now()
+	a := newProvider(0, "http://a.invalid", 1000, map[string]float64{"eth_getLogs": 1})
+	a.budget.last, a.methods["eth_getLogs"].last = now, now
+	a.methods["eth_getLogs"].take(1)
+
+	g := &rpcGateway{wake: make(chan struct{}, 1)}
+	logs := &rpcTicket{provider: a, method: "eth_getLogs", cost: methodCost("eth_getLogs"), granted: make(chan struct{})}
+	moreLogs := &rpcTicket{provider: a, method: "eth_getLogs", cost: methodCost("eth_getLogs"), granted: make(chan struct{})}
+	call := &rpcTicket{provider: a, method: "eth_call", cost: methodCost("eth_call"), granted: make(chan struct{})}
+	g.waiting[priorityLive] = []*rpcTicket{logs}
+	g.waiting[priorityEnrichment] = []*rpcTicket{moreLogs, call}
+
+	if ok, _ := g.grant(now); !ok || !granted(call) || granted(logs) || granted(moreLogs) {
+		t.Error("a call waited behind eth_getLogs rate limit")
+	}
+
+	// a cancelled ticket is dropped, not granted
+	logs.cancelled = true
+	if ok, _ := g.grant(now.Add(time.Second)); !ok || granted(logs) || !granted(moreLogs) {
+		t.Error("the cancelled ticket was not skipped")
+	}
+	if n := len(g.waiting[priorityLive]) + len(g.waiting[priorityEnrichment]); n != 0 {
+		t.Errorf("%d tickets are still waiting", n)
+	}
+}
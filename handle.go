@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"strings"
 	"sync"
@@ -11,71 +12,220 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/ethclient"
 
 	"snipr/schemas"
 )
 
-func listenForPools(exchange *schemas.Exchange, wg *sync.WaitGroup, client *ethclient.Client) {
-	defer wg.Done()
+// poolListener turns the pool creation logs of one factory into contracts.
+type poolListener struct {
+	exchange    *schemas.Exchange
+	address     common.Address
+	contractAbi abi.ABI
+	eventName   string
+	eventID     common.Hash
+	chain       *schemas.Chain
 
-	contractAddress := common.HexToAddress(exchange.Address)
-	query := ethereum.FilterQuery{
-		Addresses: []common.Address{contractAddress},
-	}
+	gateway  *rpcGateway
+	enricher *enricher
+}
 
+// poolEvent parses the exchange's ABI and checks that it has the event the
+// exchange announces new pools with.
+func poolEvent(exchange *schemas.Exchange) (abi.ABI, string, error) {
 	contractAbi, err := abi.JSON(strings.NewReader(exchange.ABI))
 	if err != nil {
-		log.Printf("Failed to parse ABI for exchange %s: %v", exchange.Address, err)
+		return abi.ABI{}, "", fmt.Errorf("failed to parse ABI for exchange %s: %w", exchange.Address, err)
+	}
+
+	if _, ok := contractAbi.Events[exchange.Event]; !ok {
+		return abi.ABI{}, "", fmt.Errorf("no '%s' event found in ABI for %s", exchange.Event, exchange.Address)
+	}
+
+	return contractAbi, exchange.Event, nil
+}
+
+func newPoolListener(exchange *schemas.Exchange, gateway *rpcGateway, enricher *enricher) (*poolListener, error) {
+	contractAbi, eventName, err := poolEvent(exchange)
+	if err != nil {
+		return nil, err
+	}
+
+	return &poolListener{
+		exchange:    exchange,
+		address:     common.HexToAddress(exchange.Address),
+		contractAbi: contractAbi,
+		eventName:   eventName,
+		eventID:     contractAbi.Events[eventName].ID,
+		chain:       schemas.ChainByID(gateway.ChainID().Uint64()),
+		gateway:     gateway,
+		enricher:    enricher,
+	}, nil
+}
+
+// handle decodes a log and leaves the calls that complete the contract to the
+// enricher, so a slow provider does not hold up the logs behind it. block is
+// the ticket of the block the log is part of, nil for logs that arrive one by
+// one.
+func (l *poolListener) handle(vLog types.Log, receivedAt time.Time, block *blockTicket) {
+	contract, err := l.exchange.Process(vLog, l.contractAbi, l.eventName)
+	if err != nil {
+		log.Printf("Error processing log for exchange %s: %v", l.exchange.Address, err)
 		return
 	}
 
-	var eventName string
-	if _, ok := contractAbi.Events["PairCreated"]; ok {
-		eventName = "PairCreated" // Uniswap V2
-	} else if _, ok := contractAbi.Events["PoolCreated"]; ok {
-		eventName = "PoolCreated" // Uniswap V3
-	} else if _, ok := contractAbi.Events["Initialize"]; ok {
-		eventName = "Initialize" // Uniswap V4
-	} else {
-		log.Printf("No 'PoolCreated' or 'PairCreated' event found in ABI for %s", exchange.Address)
+	contract.ChainID = l.chain.ID
+	if block != nil {
+		block.pending.Add(1)
+	}
+	l.enricher.push(&discovery{
+		contract:   contract,
+		listener:   l,
+		vLog:       vLog,
+		receivedAt: receivedAt,
+		block:      block,
+	})
+}
+
+type routeKey struct {
+	Address common.Address
+	Topic   common.Hash
+}
+
+// logRouter covers the factories of every exchange on the chain with a single
+// filter and hands each log to the exchange it belongs to by factory address
+// and event topic.
+type logRouter struct {
+	name   string
+	routes map[routeKey]*poolListener
+	query  ethereum.FilterQuery
+
+	// blocks writes whole blocks with --ingest=blocks
+	blocks *blockWriter
+
+	// startBlock is the earliest block any of the factories was deployed in,
+	// 0 if none is known
+	startBlock uint64
+}
+
+func newLogRouter(exchanges []*schemas.Exchange, gateway *rpcGateway, enricher *enricher) *logRouter {
+	r := &logRouter{
+		name:   fmt.Sprintf("chain %s", gateway.ChainID()),
+		routes: make(map[routeKey]*poolListener),
+		query:  ethereum.FilterQuery{Topics: [][]common.Hash{nil}},
+	}
+
+	addresses := make(map[common.Address]bool)
+	topics := make(map[common.Hash]bool)
+	for _, exchange := range exchanges {
+		listener, err := newPoolListener(exchange, gateway, enricher)
+		if err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+
+		key := routeKey{Address: listener.address, Topic: listener.eventID}
+		if other, ok := r.routes[key]; ok {
+			log.Printf("Exchanges %s and %s share factory %s, ignoring %s", other.exchange.Name, exchange.Name, exchange.Address, exchange.Name)
+			continue
+		}
+		r.routes[key] = listener
+
+		if !addresses[listener.address] {
+			addresses[listener.address] = true
+			r.query.Addresses = append(r.query.Addresses, listener.address)
+		}
+		if !topics[listener.eventID] {
+			topics[listener.eventID] = true
+			r.query.Topics[0] = append(r.query.Topics[0], listener.eventID)
+		}
+
+		if exchange.StartBlock == 0 {
+			if *backfill { log.Printf("Start block of %s on %s is not known, a backfill may miss its first pools", exchange.Name, r.name) }
+		} else if r.startBlock == 0 || exchange.StartBlock < r.startBlock {
+			r.startBlock = exchange.StartBlock
+		}
+
+		log.Printf("Listening for %s events on contract: %s", listener.eventName, exchange.Address)
+	}
+
+	return r
+}
+
+// route finds the listener of the factory and event a log is from, nil if
+// there is none.
+func (r *logRouter) route(vLog types.Log) *poolListener {
+	if len(vLog.Topics) == 0 {
+		return nil
+	}
+	return r.routes[routeKey{Address: vLog.Address, Topic: vLog.Topics[0]}]
+}
+
+func (r *logRouter) handle(vLog types.Log, receivedAt time.Time) {
+	if listener := r.route(vLog); listener != nil {
+		listener.handle(vLog, receivedAt, nil)
+	}
+}
+
+// listenForPools keeps one log subscription open for the factories of every
+// exchange.
+func listenForPools(exchanges []*schemas.Exchange, wg *sync.WaitGroup, gateway *rpcGateway, enricher *enricher) {
+	defer wg.Done()
+
+	router := newLogRouter(exchanges, gateway, enricher)
+	if len(router.routes) == 0 {
+		return
+	}
+
+	name := router.name
+	query := router.query
+	handle := router.handle
+
+	if *logQuorum > 1 {
+		listenQuorum(name, query, gateway, *logQuorum, handle)
 		return
 	}
 
-	eventID := contractAbi.Events[eventName].ID
-	log.Printf("Listening for %s events on contract: %s", eventName, exchange.Address)
+	merger := newLogMerger(name, nil, 0, handle)
+	cursor := &subscriptionCursor{name: name}
 
 	// wss reconnection loop
 	for {
 		logs := make(chan types.Log)
-		sub, err := client.SubscribeFilterLogs(context.Background(), query, logs)
+		changed := gateway.preferredChanged()
+		sub, provider, err := gateway.SubscribeFilterLogs(context.Background(), priorityLive, query, logs)
 		if err != nil {
-			log.Printf("Failed to subscribe to logs for exchange %s: %v. Retrying in 5s...", exchange.Address, err)
+			log.Printf("Failed to subscribe to logs on %s: %v. Retrying in 5s...", name, err)
 			time.Sleep(5 * time.Second)
 			continue // resubscribe
 		}
 
+		if *verbose { log.Printf("Subscribed to %d factories on %s via %s", len(query.Addresses), name, provider) }
+
+		// catch up on what was missed while disconnected
+		if from := cursor.resumeFrom(); from > 0 {
+			go merger.fillGap(gateway, nil, query, from)
+		}
+		cursor.subscribed(gateway)
+
 		// process events
 		func() {
 			defer sub.Unsubscribe()
 			for {
 				select {
 				case err := <-sub.Err():
-					log.Printf("Subscription dropped for exchange %s: %v. Reconnecting...", exchange.Address, err)
-					return 
+					log.Printf("Subscription dropped for %s on %s: %v. Reconnecting...", name, provider, err)
+					return
 
-				case vLog := <-logs:
-					if len(vLog.Topics) == 0 || vLog.Topics[0] != eventID {
-						continue 
+				case <-changed:
+					changed = gateway.preferredChanged()
+					if preferred := gateway.preferredName(); preferred != provider {
+						log.Printf("Moving %s subscription from %s to %s", name, provider, preferred)
+						return
 					}
 
-					contract, err := exchange.Process(vLog, contractAbi, eventName)
-					if err != nil {
-						log.Printf("Error processing log for exchange %s: %v", exchange.Address, err)
-						continue 
-					}
-
-					if !*disableDB { go pushNewContract(contract) }
+				case vLog := <-logs:
+					cursor.delivered(vLog)
+					merger.add(provider, vLog)
 				}
 			}
 		}()
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"expvar"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"snipr/schemas"
+)
+
+var metricHooksAnalyzed = expvar.NewMap("hooks_analyzed") // by risk
+
+// EVM opcodes that let a contract change what it does after deployment
+const (
+	opPush1        = 0x60
+	opPush32       = 0x7f
+	opDelegateCall = 0xf4
+	opSelfDestruct = 0xff
+)
+
+type hookCode struct {
+	delegateCall bool
+	selfDestruct bool
+}
+
+// scanHookCode walks the runtime code looking for DELEGATECALL and
+// SELFDESTRUCT. Push data and the Solidity metadata trailer are skipped so
+// their bytes are not mistaken for opcodes.
+func scanHookCode(code []byte) hookCode {
+	code = code[:len(code)-metadataLength(code)]
+
+	var found hookCode
+	for i := 0; i < len(code); i++ {
+		switch op := code[i]; {
+		case op >= opPush1 && op <= opPush32:
+			i += int(op-opPush1) + 1
+		case op == opDelegateCall:
+			found.delegateCall = true
+		case op == opSelfDestruct:
+			found.selfDestruct = true
+		}
+	}
+	return found
+}
+
+// metadataLength is the length of the Solidity metadata trailer code ends in,
+// 0 if there is none. The last two bytes give the length of the CBOR map
+// before them, but the hook's author controls those bytes too, so they are
+// only trusted when the map is one solc emits: up to five entries keyed ipfs,
+// bzzr0, bzzr1, solc or experimental, taking up exactly that length.
+func metadataLength(code []byte) int {
+	n := len(code)
+	if n < 3 {
+		return 0
+	}
+	length := int(binary.BigEndian.Uint16(code[n-2:]))
+	if length == 0 || length+2 > n {
+		return 0
+	}
+	meta := code[n-2-length : n-2]
+
+	entries := int(meta[0]) - 0xa0
+	if entries < 1 || entries > 5 {
+		return 0
+	}
+
+	pos, compiler := 1, false
+	for i := 0; i < entries; i++ {
+		major, key, next, ok := cborItem(meta, pos)
+		if !ok || major != cborText {
+			return 0
+		}
+		switch string(key) {
+		case "ipfs", "bzzr0", "bzzr1", "solc":
+			compiler = true
+		case "experimental":
+		default:
+			return 0
+		}
+
+		if _, _, pos, ok = cborItem(meta, next); !ok {
+			return 0
+		}
+	}
+	if !compiler || pos != len(meta) {
+		return 0
+	}
+	return length + 2
+}
+
+// CBOR major types found in Solidity metadata
+const (
+	cborBytes  = 2
+	cborText   = 3
+	cborSimple = 7
+)
+
+// cborItem reads the byte string, text string or boolean at pos and returns
+// its major type, its content and where the next item starts.
+func cborItem(b []byte, pos int) (major byte, content []byte, next int, ok bool) {
+	if pos >= len(b) {
+		return 0, nil, 0, false
+	}
+	major, info := b[pos]>>5, int(b[pos]&0x1f)
+	pos++
+
+	switch major {
+	case cborBytes, cborText:
+		if info == 24 {
+			if pos >= len(b) {
+				return 0, nil, 0, false
+			}
+			info = int(b[pos])
+			pos++
+		} else if info > 24 {
+			return 0, nil, 0, false
+		}
+		if pos+info > len(b) {
+			return 0, nil, 0, false
+		}
+		return major, b[pos : pos+info], pos + info, true
+
+	case cborSimple:
+		// false and true
+		if info != 20 && info != 21 {
+			return 0, nil, 0, false
+		}
+		return major, nil, pos, true
+	}
+
+	return 0, nil, 0, false
+}
+
+// analyzeHook fingerprints the code of c's hook and raises its risk when the
+// code can change after the pool was created, e.g. a proxy that delegates to
+// an upgradeable implementation. Hooks in the known hook registry get its
+// label, which overrides the risk judged from the hook itself (see labelHook
+// for the exception).
+func analyzeHook(gateway *rpcGateway, c *schemas.Contract) {
+	hooks := common.HexToAddress(c.Hooks)
+	if hooks == (common.Address{}) {
+		return
+	}
+	var delegates bool
+	defer func() { labelHook(gateway.ChainID().Uint64(), c, delegates) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	code, err := gateway.CodeAt(ctx, priorityLive, hooks, nil)
+	if err != nil {
+		log.Printf("Error fetching code of hook %s for pool %s: %v", c.Hooks, c.PoolAddress, err)
+		return
+	}
+	if len(code) == 0 {
+		log.Printf("Hook %s of pool %s has no code", c.Hooks, c.PoolAddress)
+		return
+	}
+	c.HookCodeHash = crypto.Keccak256Hash(code).Hex()
+
+	var mutable []string
+	found := scanHookCode(code)
+	delegates = found.delegateCall
+	if found.delegateCall {
+		mutable = append(mutable, "delegatecall")
+	}
+	if found.selfDestruct {
+		mutable = append(mutable, "selfdestruct")
+	}
+	if len(mutable) > 0 {
+		c.HookRisk = schemas.RaiseHookRisk(c.HookRisk)
+	}
+
+	if *verbose { log.Printf("Hook %s of pool %s: risk %s, code %s (%s)", c.Hooks, c.PoolAddress, c.HookRisk, c.HookCodeHash, strings.Join(mutable, ", ")) }
+}
+
+// labelHook applies the known hook registry to c and warns about hooks that
+// can block sells, unless they are known to be benign.
+//
+// Code that delegates runs whatever it points to, and every minimal or
+// ERC-1967 proxy has the same code whatever that is. So a hook that delegates
+// is only vouched for by a label on its address, a benign label on its code
+// hash is ignored.
+func labelHook(chainID uint64, c *schemas.Contract, delegates bool) {
+	known := knownHooks.lookup(chainID, c.Hooks, c.HookCodeHash)
+	if known != nil && known.Address == "" && delegates && known.Label == schemas.HookLabelBenign {
+		if *verbose { log.Printf("Hook %s of pool %s delegates, ignoring the benign label of its code %s", c.Hooks, c.PoolAddress, c.HookCodeHash) }
+		known = nil
+	}
+	if known != nil {
+		c.HookLabel = known.Label
+		if risk := schemas.HookRiskForLabel(known.Label); risk != "" {
+			c.HookRisk = risk
+		}
+	}
+
+	metricHooksAnalyzed.Add(c.HookRisk, 1)
+
+	if c.HookRisk != schemas.HookRiskHigh {
+		return
+	}
+
+	label := c.HookLabel
+	if label == "" {
+		label = "unknown"
+	}
+	log.Printf("Warning: pool %s on %s has %s hook %s that can block or tax sells (%s)",
+		c.PoolAddress, c.Exchange, label, c.Hooks, strings.Join(schemas.HookFlagNames(c.HookFlags), ", "))
+}
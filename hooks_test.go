@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// solcTrailer is the metadata solc appends: {"ipfs": <34 bytes>, "solc":
+// <version>} followed by its length. The hash is full of opcode bytes.
+func solcTrailer() []byte {
+	hash := append([]byte{0x12, 0x20}, bytes.Repeat([]byte{opDelegateCall, opSelfDestruct}, 16)...)
+	meta := []byte{0xa2, 0x64}
+	meta = append(meta, "ipfs"...)
+	meta = append(meta, 0x58, 0x22)
+	meta = append(meta, hash...)
+	meta = append(meta, 0x64)
+	meta = append(meta, "solc"...)
+	meta = append(meta, 0x43, 0x00, 0x08, 0x1a)
+	return append(meta, 0x00, byte(len(meta)))
+}
+
+func joinBytes(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestMetadataLength(t *testing.T) {
+	code := []byte{0x60, 0x80, 0x60, 0x40, 0x52, 0x00} // PUSH1 0x80 PUSH1 0x40 MSTORE STOP
+	trailer := solcTrailer()
+
+	// a map with just the experimental flag, which solc never emits alone
+	experimental := []byte{0xa1, 0x6c}
+	experimental = append(experimental, "experimental"...)
+	experimental = append(experimental, 0xf5)
+	experimental = append(experimental, 0x00, byte(len(experimental)))
+
+	// a map under a key solc does not use
+	unknownKey := []byte{0xa1, 0x64}
+	unknownKey = append(unknownKey, "evil"...)
+	unknownKey = append(unknownKey, 0x41, opDelegateCall)
+	unknownKey = append(unknownKey, 0x00, byte(len(unknownKey)))
+
+	for _, tt := range []struct {
+		name string
+		code []byte
+		want int
+	}{
+		{"solc trailer", joinBytes(code, trailer), len(trailer)},
+		{"no trailer", code, 0},
+		{"empty code", nil, 0},
+		{"length past the start of the code", []byte{0xa1, 0xff, 0xff}, 0},
+		{"zero length", joinBytes(code, []byte{0x00, 0x00}), 0},
+		{"forged length over a DELEGATECALL", joinBytes(code, []byte{opDelegateCall, 0x00, 0x01}), 0},
+		{"forged length over code and trailer", joinBytes(code, trailer[:len(trailer)-2], []byte{0x00, byte(len(trailer) - 2 + len(code))}), 0},
+		{"only experimental", joinBytes(code, experimental), 0},
+		{"unknown key", joinBytes(code, unknownKey), 0},
+		{"truncated map", joinBytes(code, trailer[:10], []byte{0x00, 10}), 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := metadataLength(tt.code); got != tt.want {
+				t.Errorf("metadataLength is %d, expected %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanHookCode(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		code []byte
+		want hookCode
+	}{
+		{"DELEGATECALL", []byte{0x60, 0x00, opDelegateCall, 0x00}, hookCode{delegateCall: true}},
+		{"SELFDESTRUCT", []byte{0x33, opSelfDestruct}, hookCode{selfDestruct: true}},
+		{"both", []byte{opSelfDestruct, opDelegateCall}, hookCode{delegateCall: true, selfDestruct: true}},
+		{"PUSH1 data", []byte{0x60, opDelegateCall, 0x60, opSelfDestruct, 0x00}, hookCode{}},
+		{"PUSH32 data", joinBytes([]byte{opPush32}, bytes.Repeat([]byte{opSelfDestruct}, 32), []byte{0x00}), hookCode{}},
+		{"opcode after PUSH data", []byte{0x61, opDelegateCall, opDelegateCall, opSelfDestruct}, hookCode{selfDestruct: true}},
+		{"truncated PUSH", []byte{0x00, opPush32, opDelegateCall}, hookCode{}},
+		{"solc trailer", joinBytes([]byte{0x60, 0x00, 0x00}, solcTrailer()), hookCode{}},
+		{"forged trailer", []byte{0x00, opDelegateCall, 0x00, 0x02}, hookCode{delegateCall: true}},
+		{"empty code", nil, hookCode{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scanHookCode(tt.code); got != tt.want {
+				t.Errorf("scanHookCode is %+v, expected %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"snipr/schemas"
+)
+
+// knownHooksRefresh is how often a running snipr picks up labels changed with
+// `snipr hooks`.
+const knownHooksRefresh = time.Minute
+
+// HookStore keeps the known hook registry. The SQL and memory stores
+// implement it next to Repository.
+type HookStore interface {
+	ListKnownHooks() ([]*schemas.KnownHook, error)
+	SaveKnownHook(h *schemas.KnownHook) error
+	DeleteKnownHook(chainID uint64, address, codeHash string) error
+}
+
+func knownHookKey(chainID uint64, address, codeHash string) string {
+	return fmt.Sprintf("%d:%s:%s", chainID, strings.ToLower(address), strings.ToLower(codeHash))
+}
+
+// normalizeKnownHook checks h and brings its address and code hash into the
+// form lookups use.
+func normalizeKnownHook(h *schemas.KnownHook) error {
+	if h.ChainID == 0 {
+		return errors.New("chain ID is required")
+	}
+	if !schemas.ValidHookLabel(h.Label) {
+		return fmt.Errorf("unknown label %q (expected one of %s)", h.Label, strings.Join(schemas.HookLabels, ", "))
+	}
+	if (h.Address == "") == (h.CodeHash == "") {
+		return errors.New("exactly one of address and code hash is required")
+	}
+
+	if h.Address != "" {
+		if !common.IsHexAddress(h.Address) {
+			return fmt.Errorf("invalid address %q", h.Address)
+		}
+		h.Address = common.HexToAddress(h.Address).Hex()
+	}
+	if h.CodeHash != "" {
+		if b := common.FromHex(h.CodeHash); len(b) != common.HashLength {
+			return fmt.Errorf("invalid code hash %q", h.CodeHash)
+		}
+		h.CodeHash = common.HexToHash(h.CodeHash).Hex()
+	}
+	return nil
+}
+
+// hookRegistry is the in-memory copy of the known hooks the enricher looks
+// hooks up in.
+type hookRegistry struct {
+	mu        sync.RWMutex
+	byAddress map[string]*schemas.KnownHook
+	byCode    map[string]*schemas.KnownHook
+}
+
+var knownHooks = &hookRegistry{}
+
+func (r *hookRegistry) load(store HookStore) (int, error) {
+	hooks, err := store.ListKnownHooks()
+	if err != nil {
+		return 0, err
+	}
+
+	byAddress := make(map[string]*schemas.KnownHook)
+	byCode := make(map[string]*schemas.KnownHook)
+	for _, h := range hooks {
+		if h.Address != "" {
+			byAddress[knownHookKey(h.ChainID, h.Address, "")] = h
+		} else {
+			byCode[knownHookKey(h.ChainID, "", h.CodeHash)] = h
+		}
+	}
+
+	r.mu.Lock()
+	r.byAddress, r.byCode = byAddress, byCode
+	r.mu.Unlock()
+
+	return len(hooks), nil
+}
+
+// lookup finds a hook by address first, then by code hash. Returns nil if
+// neither is known.
+func (r *hookRegistry) lookup(chainID uint64, address, codeHash string) *schemas.KnownHook {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if h, ok := r.byAddress[knownHookKey(chainID, address, "")]; ok {
+		return h
+	}
+	if codeHash == "" {
+		return nil
+	}
+	return r.byCode[knownHookKey(chainID, "", codeHash)]
+}
+
+// watchKnownHooks loads the registry from store and keeps reloading it.
+func watchKnownHooks(store HookStore) {
+	n, err := knownHooks.load(store)
+	if err != nil {
+		log.Printf("Failed to load known hooks: %v", err)
+	} else {
+		log.Printf("Loaded %d known hooks", n)
+	}
+
+	go func() {
+		ticker := time.NewTicker(knownHooksRefresh)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := knownHooks.load(store); err != nil {
+				log.Printf("Failed to reload known hooks: %v", err)
+			}
+		}
+	}()
+}
+
+// openHookStore connects the store for the hooks command.
+func openHookStore() (Repository, HookStore) {
+	store, cache := initDB()
+	if cache != nil {
+		cache.Close()
+	}
+
+	hooks, ok := store.(HookStore)
+	if !ok {
+		log.Fatalln("Known hooks need --store=postgres, sqlite or memory.")
+	}
+	return store, hooks
+}
+
+// runHooks manages the known hook registry:
+//
+//	snipr hooks list [-chain N] [-label L]
+//	snipr hooks set -chain N (-address A | -code_hash H) -label L [-name N] [-note N]
+//	snipr hooks remove -chain N (-address A | -code_hash H)
+//	snipr hooks export > hooks.json
+//	snipr hooks import hooks.json
+func runHooks(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: snipr hooks <list|set|remove|import|export> [flags]")
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+
+	fs := flag.NewFlagSet("hooks "+args[0], flag.ExitOnError)
+	chainID := fs.Uint64("chain", 0, "Chain ID the hook is deployed on")
+	address := fs.String("address", "", "Hook contract address")
+	codeHash := fs.String("code_hash", "", "keccak256 of the hook's runtime code, matches every deployment of it")
+	label := fs.String("label", "", "One of "+strings.Join(schemas.HookLabels, ", "))
+	name := fs.String("name", "", "Short name, e.g. the protocol the hook belongs to")
+	note := fs.String("note", "", "Why the hook got its label")
+	fs.Parse(args[1:])
+
+	store, hooks := openHookStore()
+	defer store.Close()
+
+	switch args[0] {
+	case "list":
+		list, err := hooks.ListKnownHooks()
+		if err != nil {
+			log.Fatalf("Failed to list known hooks: %v", err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		for _, h := range list {
+			if (*chainID != 0 && h.ChainID != *chainID) || (*label != "" && h.Label != *label) {
+				continue
+			}
+			enc.Encode(h)
+		}
+
+	case "set":
+		h := &schemas.KnownHook{
+			ChainID:   *chainID,
+			Address:   *address,
+			CodeHash:  *codeHash,
+			Label:     *label,
+			Name:      *name,
+			Note:      *note,
+			UpdatedAt: time.Now().UTC(),
+		}
+		if err := normalizeKnownHook(h); err != nil {
+			log.Fatalf("Invalid hook: %v", err)
+		}
+		if err := hooks.SaveKnownHook(h); err != nil {
+			log.Fatalf("Failed to save hook: %v", err)
+		}
+		log.Printf("Labeled %s%s on chain %d as %s", h.Address, h.CodeHash, h.ChainID, h.Label)
+
+	case "remove":
+		h := &schemas.KnownHook{ChainID: *chainID, Address: *address, CodeHash: *codeHash, Label: schemas.HookLabelBenign}
+		if err := normalizeKnownHook(h); err != nil {
+			log.Fatalf("Invalid hook: %v", err)
+		}
+		if err := hooks.DeleteKnownHook(h.ChainID, h.Address, h.CodeHash); err != nil {
+			log.Fatalf("Failed to remove hook: %v", err)
+		}
+		log.Printf("Removed %s%s on chain %d", h.Address, h.CodeHash, h.ChainID)
+
+	case "export":
+		list, err := hooks.ListKnownHooks()
+		if err != nil {
+			log.Fatalf("Failed to list known hooks: %v", err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(list)
+
+	case "import":
+		if fs.NArg() != 1 {
+			usage()
+		}
+		importKnownHooks(hooks, fs.Arg(0))
+
+	default:
+		usage()
+	}
+}
+
+// importKnownHooks saves every hook in a file written by `snipr hooks
+// export`, or "-" for stdin. Nothing is saved if any entry is invalid.
+func importKnownHooks(hooks HookStore, path string) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", path, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var list []*schemas.KnownHook
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		log.Fatalf("Failed to read %s: %v", path, err)
+	}
+
+	for i, h := range list {
+		if err := normalizeKnownHook(h); err != nil {
+			log.Fatalf("Entry %d of %s is invalid: %v", i, path, err)
+		}
+		if h.UpdatedAt.IsZero() {
+			h.UpdatedAt = time.Now().UTC()
+		}
+	}
+
+	for _, h := range list {
+		if err := hooks.SaveKnownHook(h); err != nil {
+			log.Fatalf("Failed to save hook %s%s: %v", h.Address, h.CodeHash, err)
+		}
+	}
+	log.Printf("Imported %d known hooks", len(list))
+}
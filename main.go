@@ -3,7 +3,10 @@ package main
 import (
 	"flag"
 	"log"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 
 	"snipr/schemas"
 	"snipr/schemas/dex"
@@ -12,33 +15,129 @@ import (
 func main() {
 	flag.Parse()
 
-	if *disableDB { 
-		log.Println("Database disabled, skipping connection.") 
-	} else { 
-		initDB() 
+	if cmd, ok := commands[flag.Arg(0)]; ok {
+		cmd(flag.Args()[1:])
+		return
 	}
 
-	client := auth()
+	store, cache := initDB()
+	backends := dbBackends(store, cache)
+	if hooks, ok := store.(HookStore); ok {
+		watchKnownHooks(hooks)
+	}
+
+	serveMetrics(*metricsAddr)
+
+	switch *ingest {
+	case "subscribe", "blocks", "poll":
+	default:
+		log.Fatalf("Unknown --ingest %q, expected subscribe, blocks or poll", *ingest)
+	}
+	if *backfill && *ingest != "poll" {
+		log.Fatalln("--backfill needs --ingest=poll")
+	}
+
+	// a zero would deadlock pushes or panic the batch ticker
+	for name, value := range map[string]int{"queue_size": *queueSize, "write_workers": *writeWorkers, "batch_size": *batchSize, "enrich_workers": *enrichWorkers} {
+		if value < 1 {
+			log.Fatalf("--%s must be at least 1, got %d", name, value)
+		}
+	}
+	if *batchInterval <= 0 {
+		log.Fatalf("--batch_interval must be positive, got %s", *batchInterval)
+	}
+
+	gateways := connectChains()
 
-	exchanges := []*schemas.Exchange{
-		dex.UniswapV2(disableDB),
-		dex.UniswapV3(disableDB),
-		dex.UniswapV4(disableDB),
-		dex.PancakeSwapV2(disableDB), // TODO: check this implementation 
-		dex.PancakeSwapV3(disableDB), // TODO: check this implementation
-		// TODO: add PancakeSwapV4
+	queue := newWriteQueue(*queueSize, *writeWorkers, *batchSize, *batchInterval, *writeRetries, backends)
+	calls := make(map[uint64]*callBatcher)
+	for _, gateway := range gateways {
+		calls[gateway.ChainID().Uint64()] = newCallBatcher(gateway, priorityEnrichment, *multicallWindow, *multicallMaxCalls, *multicallAddress)
 	}
+	enricher := newEnricher(calls, queue, *enrichWorkers)
 
 	var wg sync.WaitGroup
-	for _, exchange := range exchanges {
+	for _, gateway := range gateways {
+		exchanges := dex.ForChain(gateway.ChainID().Uint64())
+		for _, launchpad := range dex.LaunchpadsForChain(gateway.ChainID().Uint64()) {
+			exchanges = append(exchanges, launchpad.Exchange())
+		}
+		if len(exchanges) == 0 {
+			log.Printf("No known exchange or launchpad deployments on chain %s", gateway.ChainID())
+			continue
+		}
+		if *backfill && !hasStartBlock(exchanges) {
+			log.Fatalf("No start block is known for any factory on chain %s, it cannot be backfilled", gateway.ChainID())
+		}
+
 		wg.Add(1)
-		go listenForPools(exchange, &wg, client)
+		switch *ingest {
+		case "subscribe":
+			go listenForPools(exchanges, &wg, gateway, enricher)
+		case "blocks":
+			go listenForBlocks(exchanges, &wg, gateway, enricher)
+		case "poll":
+			go pollForPools(exchanges, &wg, gateway, enricher)
+		}
+
+		if *mempool {
+			go watchMempool(exchanges, gateway)
+		}
 	}
 
 	log.Println("Started listeners for all exchanges. Waiting for events...")
-	wg.Wait()
 
-	// Since the listeners run indefinitely, you might want to handle graceful shutdown
-	// and close the channel. For this example, we'll leave it open
-	// close(results)
+	// The listeners run indefinitely, so flush pending writes on shutdown
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case sig := <-stop:
+		log.Printf("Received %s, flushing write queue...", sig)
+	case <-done:
+	}
+
+	enricher.close()
+	queue.close()
+
+	for _, r := range []Repository{store, cache} {
+		if r != nil {
+			r.Close()
+		}
+	}
+}
+
+// connectChains connects to every chain in --chains, or to the chain of
+// NODE_URL_WSS and NODE_URL_HTTP when it is empty.
+func connectChains() []*rpcGateway {
+	ids, err := parseChains(*chainsFlag)
+	if err != nil {
+		log.Fatalf("Invalid --chains: %v", err)
+	}
+	if len(ids) == 0 {
+		return []*rpcGateway{auth()}
+	}
+
+	var gateways []*rpcGateway
+	for _, id := range ids {
+		gateways = append(gateways, authChain(id))
+	}
+	return gateways
+}
+
+// hasStartBlock reports whether the block any of the exchanges' factories was
+// deployed in is known, which a backfill starts at.
+func hasStartBlock(exchanges []*schemas.Exchange) bool {
+	for _, exchange := range exchanges {
+		if exchange.StartBlock > 0 {
+			return true
+		}
+	}
+	return false
 }
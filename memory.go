@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"snipr/schemas"
+)
+
+// memoryRepository keeps contracts in process memory. Meant for tests and
+// short local runs; everything is lost on exit.
+type memoryRepository struct {
+	mu        sync.RWMutex
+	contracts map[string]*schemas.Contract // by contractKey
+	nextID    uint
+
+	hooks map[string]*schemas.KnownHook // by knownHookKey
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		contracts: make(map[string]*schemas.Contract),
+		hooks:     make(map[string]*schemas.KnownHook),
+	}
+}
+
+// contractKey identifies the event a contract was discovered from, or its
+// pool when the event is unknown.
+func contractKey(c *schemas.Contract) string {
+	if c.TxHash != "" {
+		return fmt.Sprintf("%s:%d", c.TxHash, c.LogIndex)
+	}
+	return c.Address + ":" + c.PoolAddress
+}
+
+func (r *memoryRepository) Name() string { return "memory" }
+
+func (r *memoryRepository) SaveContracts(batch []*schemas.Contract) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range batch {
+		key := contractKey(c)
+		if _, ok := r.contracts[key]; ok {
+			continue
+		}
+
+		r.nextID++
+		stored := *c
+		stored.ID = r.nextID
+		r.contracts[key] = &stored
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) GetContract(chainID uint64, address string) (*schemas.Contract, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// the token's first pool, like the SQL stores
+	var first *schemas.Contract
+	for _, c := range r.contracts {
+		if c.Address != address || (chainID != 0 && c.ChainID != chainID) {
+			continue
+		}
+		if first == nil || c.BlockNumber < first.BlockNumber || (c.BlockNumber == first.BlockNumber && c.ID < first.ID) {
+			first = c
+		}
+	}
+	if first == nil {
+		return nil, errNotFound
+	}
+	stored := *first
+	return &stored, nil
+}
+
+func (r *memoryRepository) ListContracts(q ContractQuery) ([]*schemas.Contract, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	launched := make(map[string]bool)
+	if q.Launchpad != "" {
+		for _, c := range r.contracts {
+			if c.Launchpad == q.Launchpad {
+				launched[fmt.Sprintf("%d:%s", c.ChainID, c.Address)] = true
+			}
+		}
+	}
+
+	var contracts []*schemas.Contract
+	for _, c := range r.contracts {
+		if q.ChainID != 0 && c.ChainID != q.ChainID {
+			continue
+		}
+		if q.Exchange != "" && c.Exchange != q.Exchange {
+			continue
+		}
+		if q.PoolType != "" && c.PoolType != q.PoolType {
+			continue
+		}
+		if q.Token != "" && c.Address != q.Token {
+			continue
+		}
+		if q.Launchpad != "" && !launched[fmt.Sprintf("%d:%s", c.ChainID, c.Address)] {
+			continue
+		}
+		if c.BlockNumber < q.FromBlock {
+			continue
+		}
+		stored := *c
+		contracts = append(contracts, &stored)
+	}
+
+	sort.Slice(contracts, func(i, j int) bool {
+		return contracts[i].BlockNumber > contracts[j].BlockNumber
+	})
+	if q.Limit > 0 && len(contracts) > q.Limit {
+		contracts = contracts[:q.Limit]
+	}
+
+	return contracts, nil
+}
+
+func (r *memoryRepository) RevertBlocks(chainID uint64, blockHashes []string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reverted := make(map[string]bool, len(blockHashes))
+	for _, hash := range blockHashes {
+		reverted[hash] = true
+	}
+
+	var removed int64
+	for key, c := range r.contracts {
+		if c.ChainID == chainID && reverted[c.BlockHash] {
+			delete(r.contracts, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (r *memoryRepository) ListKnownHooks() ([]*schemas.KnownHook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	hooks := make([]*schemas.KnownHook, 0, len(r.hooks))
+	for _, h := range r.hooks {
+		stored := *h
+		hooks = append(hooks, &stored)
+	}
+	return hooks, nil
+}
+
+func (r *memoryRepository) SaveKnownHook(h *schemas.KnownHook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *h
+	r.hooks[knownHookKey(h.ChainID, h.Address, h.CodeHash)] = &stored
+	return nil
+}
+
+func (r *memoryRepository) DeleteKnownHook(chainID uint64, address, codeHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := knownHookKey(chainID, address, codeHash)
+	if _, ok := r.hooks[key]; !ok {
+		return errNotFound
+	}
+	delete(r.hooks, key)
+	return nil
+}
+
+func (r *memoryRepository) Close() error { return nil }
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"snipr/schemas"
+)
+
+// minedGrace is how long a pool whose transaction was mined may take to show
+// up as a factory log before it is expired, e.g. because the pair already
+// existed and addLiquidityETH only added to it.
+const minedGrace = 30 * time.Second
+
+var (
+	metricPendingSeen      = expvar.NewMap("pending_pools_seen") // by exchange
+	metricPendingConfirmed = expvar.NewInt("pending_pools_confirmed")
+	metricPendingExpired   = expvar.NewMap("pending_pools_expired") // by reason
+	metricPendingLeadMs    = expvar.NewInt("pending_pools_lead_ms") // total time seen ahead of the log
+)
+
+type pendingEntry struct {
+	pool    *schemas.PendingPool
+	minedAt time.Time
+}
+
+// pendingTracker holds pools seen in the mempool until their factory log
+// confirms them or they expire.
+type pendingTracker struct {
+	mu    sync.Mutex
+	pools map[string]*pendingEntry // by pendingKey
+}
+
+// pendingKey identifies a pool across chains, where the same factory can
+// deploy to the same address.
+func pendingKey(chainID uint64, poolAddress string) string {
+	return fmt.Sprintf("%d:%s", chainID, strings.ToLower(poolAddress))
+}
+
+var pendingPools = &pendingTracker{pools: make(map[string]*pendingEntry)}
+
+func init() {
+	expvar.Publish("pending_pools", expvar.Func(func() any {
+		pendingPools.mu.Lock()
+		defer pendingPools.mu.Unlock()
+		return len(pendingPools.pools)
+	}))
+}
+
+func (t *pendingTracker) add(p *schemas.PendingPool) bool {
+	key := pendingKey(p.ChainID, p.PoolAddress)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.pools[key]; ok {
+		return false
+	}
+	t.pools[key] = &pendingEntry{pool: p}
+	return true
+}
+
+// confirm resolves the pending pool c was created as, if there was one.
+func (t *pendingTracker) confirm(c *schemas.Contract) {
+	if c.PoolAddress == "" {
+		return
+	}
+	key := pendingKey(c.ChainID, c.PoolAddress)
+
+	t.mu.Lock()
+	e, ok := t.pools[key]
+	delete(t.pools, key)
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	lead := c.ReceivedAt.Sub(e.pool.SeenAt)
+	metricPendingConfirmed.Add(1)
+	metricPendingLeadMs.Add(lead.Milliseconds())
+	log.Printf("Pending %s pool %s confirmed in block %d, seen %s ahead of its log", e.pool.Exchange, c.PoolAddress, c.BlockNumber, lead)
+}
+
+func (t *pendingTracker) expire(key, reason string) {
+	t.mu.Lock()
+	e, ok := t.pools[key]
+	delete(t.pools, key)
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	metricPendingExpired.Add(reason, 1)
+	if *verbose { log.Printf("Pending %s pool %s expired: %s (tx %s)", e.pool.Exchange, e.pool.PoolAddress, reason, e.pool.TxHash) }
+}
+
+// check expires pools on the gateway's chain whose transaction reverted, was
+// mined without creating the pool, or never made it into a block within
+// --pending_ttl.
+func (t *pendingTracker) check(gateway *rpcGateway) {
+	now := time.Now().UTC()
+	chainID := gateway.ChainID().Uint64()
+
+	t.mu.Lock()
+	entries := make(map[string]pendingEntry, len(t.pools))
+	for key, e := range t.pools {
+		if e.pool.ChainID == chainID {
+			entries[key] = *e
+		}
+	}
+	t.mu.Unlock()
+
+	for key, e := range entries {
+		switch {
+		case now.Sub(e.pool.SeenAt) > *pendingTTL:
+			t.expire(key, "not mined")
+			continue
+		case !e.minedAt.IsZero():
+			if now.Sub(e.minedAt) > minedGrace {
+				t.expire(key, "mined without pool")
+			}
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		receipt, err := gateway.TransactionReceipt(ctx, priorityBackfill, common.HexToHash(e.pool.TxHash))
+		cancel()
+		if err != nil {
+			// still pending, or the lookup failed and is retried next round
+			continue
+		}
+
+		if receipt.Status == types.ReceiptStatusFailed {
+			t.expire(key, "reverted")
+			continue
+		}
+
+		t.mu.Lock()
+		if live, ok := t.pools[key]; ok {
+			live.minedAt = now
+		}
+		t.mu.Unlock()
+	}
+}
+
+// watchMempool decodes pending transactions to the factories and routers of
+// every exchange and reports the pools they will create before the factory
+// log exists. The pools are confirmed when their log arrives.
+func watchMempool(exchanges []*schemas.Exchange, gateway *rpcGateway) {
+	var decoders []func(tx *types.Transaction) []*schemas.PendingPool
+	for _, exchange := range exchanges {
+		if exchange.DecodePending != nil {
+			decoders = append(decoders, exchange.DecodePending)
+		}
+	}
+	if len(decoders) == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			pendingPools.check(gateway)
+		}
+	}()
+
+	// wss reconnection loop
+	for {
+		txs := make(chan *types.Transaction)
+		changed := gateway.preferredChanged()
+		sub, provider, err := gateway.SubscribePendingTransactions(context.Background(), priorityLive, txs)
+		if err != nil {
+			log.Printf("Failed to subscribe to pending transactions: %v. Retrying in 30s...", err)
+			time.Sleep(30 * time.Second)
+			continue // resubscribe
+		}
+
+		log.Printf("Watching the mempool via %s", provider)
+
+		func() {
+			defer sub.Unsubscribe()
+			for {
+				select {
+				case err := <-sub.Err():
+					log.Printf("Pending transaction subscription dropped on %s: %v. Reconnecting...", provider, err)
+					return
+
+				case <-changed:
+					changed = gateway.preferredChanged()
+					if preferred := gateway.preferredName(); preferred != provider {
+						log.Printf("Moving pending transaction subscription from %s to %s", provider, preferred)
+						return
+					}
+
+				case tx := <-txs:
+					for _, decode := range decoders {
+						for _, pool := range decode(tx) {
+							go reportPending(gateway, tx, pool)
+						}
+					}
+				}
+			}
+		}()
+
+		// avoid spamming node on reconnect
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// reportPending records a decoded pool unless its address already holds a
+// contract, which means the call only adds to an existing pool. V4 pool IDs
+// are not addresses, their decoders only report pools the call initializes.
+func reportPending(gateway *rpcGateway, tx *types.Transaction, pool *schemas.PendingPool) {
+	pool.ChainID = gateway.ChainID().Uint64()
+	pool.TxHash = tx.Hash().Hex()
+	pool.SeenAt = time.Now().UTC()
+	if sender, err := gateway.TransactionSender(tx); err == nil {
+		pool.TxSender = sender.Hex()
+	}
+
+	if common.IsHexAddress(pool.PoolAddress) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		code, err := gateway.CodeAt(ctx, priorityLive, common.HexToAddress(pool.PoolAddress), nil)
+		cancel()
+		if err == nil && len(code) > 0 {
+			return
+		}
+	}
+
+	if !pendingPools.add(pool) {
+		return
+	}
+
+	metricPendingSeen.Add(pool.Exchange, 1)
+	log.Printf("Pending pool on %s via %s -\nPool: %s\nToken0: %s\nToken1: %s\nTx: %s from %s\n",
+		pool.Exchange,
+		pool.Method,
+		pool.PoolAddress,
+		pool.Token0,
+		pool.Token1,
+		pool.TxHash,
+		pool.TxSender,
+	)
+}
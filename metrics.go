@@ -0,0 +1,30 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+)
+
+// Counters are published through expvar and served on /debug/vars when
+// --metrics_addr is set.
+var (
+	metricWritten      = expvar.NewMap("contracts_written")
+	metricFailed       = expvar.NewMap("contracts_failed")
+	metricWriteRetries = expvar.NewInt("write_retries")
+	metricQueueBlocked = expvar.NewInt("write_queue_blocked")
+	metricReverted     = expvar.NewMap("contracts_reverted") // by backend
+)
+
+func serveMetrics(addr string) {
+	if addr == "" {
+		return
+	}
+
+	go func() {
+		log.Printf("Serving metrics on %s/debug/vars", addr)
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,663 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// sqlSteps holds the statements of one migration direction per dialect
+// ("postgres", "sqlite"). Statements under "*" are used for any dialect that
+// has no entry of its own.
+type sqlSteps map[string][]string
+
+func (s sqlSteps) forDialect(dialect string) []string {
+	if steps, ok := s[dialect]; ok {
+		return steps
+	}
+	return s["*"]
+}
+
+type migration struct {
+	version int
+	name    string
+	up      sqlSteps
+	down    sqlSteps
+}
+
+// migrations are applied in order and must never be edited once released;
+// add a new version instead. Version 1 matches the table gorm's AutoMigrate
+// used to create, so existing databases can adopt it without changes.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create contracts",
+		up: sqlSteps{
+			"postgres": {
+				`CREATE TABLE IF NOT EXISTS contracts (
+					id bigserial PRIMARY KEY,
+					created_at timestamptz,
+					updated_at timestamptz,
+					deleted_at timestamptz,
+					address text NOT NULL,
+					backing_coin_address text,
+					exchange text,
+					block_number bigint
+				)`,
+			},
+			"sqlite": {
+				`CREATE TABLE IF NOT EXISTS contracts (
+					id integer PRIMARY KEY AUTOINCREMENT,
+					created_at datetime,
+					updated_at datetime,
+					deleted_at datetime,
+					address text NOT NULL,
+					backing_coin_address text,
+					exchange text,
+					block_number integer
+				)`,
+			},
+		},
+		down: sqlSteps{
+			"*": {`DROP TABLE contracts`},
+		},
+	},
+	{
+		version: 2,
+		name:    "index contracts",
+		up: sqlSteps{
+			"*": {
+				`CREATE UNIQUE INDEX IF NOT EXISTS idx_contracts_address ON contracts (address)`,
+				`CREATE INDEX IF NOT EXISTS idx_contracts_exchange ON contracts (exchange)`,
+				`CREATE INDEX IF NOT EXISTS idx_contracts_block_number ON contracts (block_number)`,
+				`CREATE INDEX IF NOT EXISTS idx_contracts_deleted_at ON contracts (deleted_at)`,
+			},
+		},
+		down: sqlSteps{
+			"*": {
+				`DROP INDEX IF EXISTS idx_contracts_address`,
+				`DROP INDEX IF EXISTS idx_contracts_exchange`,
+				`DROP INDEX IF EXISTS idx_contracts_block_number`,
+				`DROP INDEX IF EXISTS idx_contracts_deleted_at`,
+			},
+		},
+	},
+	{
+		version: 3,
+		name:    "add contract provenance",
+		up: sqlSteps{
+			"postgres": {
+				`ALTER TABLE contracts ADD COLUMN tx_hash text`,
+				`ALTER TABLE contracts ADD COLUMN log_index bigint NOT NULL DEFAULT 0`,
+				`ALTER TABLE contracts ADD COLUMN block_hash text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN block_timestamp timestamptz`,
+				`ALTER TABLE contracts ADD COLUMN factory text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN tx_sender text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN received_at timestamptz`,
+				`CREATE UNIQUE INDEX idx_contracts_tx_log ON contracts (tx_hash, log_index)`,
+				`CREATE INDEX idx_contracts_factory ON contracts (factory)`,
+			},
+			"sqlite": {
+				`ALTER TABLE contracts ADD COLUMN tx_hash text`,
+				`ALTER TABLE contracts ADD COLUMN log_index integer NOT NULL DEFAULT 0`,
+				`ALTER TABLE contracts ADD COLUMN block_hash text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN block_timestamp datetime`,
+				`ALTER TABLE contracts ADD COLUMN factory text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN tx_sender text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN received_at datetime`,
+				`CREATE UNIQUE INDEX idx_contracts_tx_log ON contracts (tx_hash, log_index)`,
+				`CREATE INDEX idx_contracts_factory ON contracts (factory)`,
+			},
+		},
+		down: sqlSteps{
+			"*": {
+				`DROP INDEX idx_contracts_factory`,
+				`DROP INDEX idx_contracts_tx_log`,
+				`ALTER TABLE contracts DROP COLUMN received_at`,
+				`ALTER TABLE contracts DROP COLUMN tx_sender`,
+				`ALTER TABLE contracts DROP COLUMN factory`,
+				`ALTER TABLE contracts DROP COLUMN block_timestamp`,
+				`ALTER TABLE contracts DROP COLUMN block_hash`,
+				`ALTER TABLE contracts DROP COLUMN log_index`,
+				`ALTER TABLE contracts DROP COLUMN tx_hash`,
+			},
+		},
+	},
+	{
+		version: 4,
+		name:    "add token metadata",
+		up: sqlSteps{
+			"*": {
+				`ALTER TABLE contracts ADD COLUMN token_name text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN token_symbol text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN token_decimals smallint`,
+				`ALTER TABLE contracts ADD COLUMN token_total_supply text NOT NULL DEFAULT ''`,
+				`CREATE INDEX idx_contracts_token_symbol ON contracts (token_symbol)`,
+			},
+		},
+		down: sqlSteps{
+			"*": {
+				`DROP INDEX idx_contracts_token_symbol`,
+				`ALTER TABLE contracts DROP COLUMN token_total_supply`,
+				`ALTER TABLE contracts DROP COLUMN token_decimals`,
+				`ALTER TABLE contracts DROP COLUMN token_symbol`,
+				`ALTER TABLE contracts DROP COLUMN token_name`,
+			},
+		},
+	},
+	{
+		version: 5,
+		name:    "add pool address",
+		up: sqlSteps{
+			"*": {
+				`ALTER TABLE contracts ADD COLUMN pool_address text NOT NULL DEFAULT ''`,
+				`CREATE INDEX idx_contracts_pool_address ON contracts (pool_address)`,
+			},
+		},
+		down: sqlSteps{
+			"*": {
+				`DROP INDEX idx_contracts_pool_address`,
+				`ALTER TABLE contracts DROP COLUMN pool_address`,
+			},
+		},
+	},
+	{
+		version: 6,
+		name:    "add pool fee and CREATE2 check",
+		up: sqlSteps{
+			"*": {
+				`ALTER TABLE contracts ADD COLUMN fee bigint NOT NULL DEFAULT 0`,
+				`ALTER TABLE contracts ADD COLUMN create2_mismatch boolean NOT NULL DEFAULT false`,
+				`CREATE INDEX idx_contracts_create2_mismatch ON contracts (create2_mismatch)`,
+			},
+		},
+		down: sqlSteps{
+			"*": {
+				`DROP INDEX idx_contracts_create2_mismatch`,
+				`ALTER TABLE contracts DROP COLUMN create2_mismatch`,
+				`ALTER TABLE contracts DROP COLUMN fee`,
+			},
+		},
+	},
+	{
+		version: 7,
+		name:    "add V4 hooks",
+		up: sqlSteps{
+			"*": {
+				`ALTER TABLE contracts ADD COLUMN hooks text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN hook_flags integer NOT NULL DEFAULT 0`,
+				`ALTER TABLE contracts ADD COLUMN hook_code_hash text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN hook_risk text NOT NULL DEFAULT ''`,
+				`CREATE INDEX idx_contracts_hooks ON contracts (hooks)`,
+				`CREATE INDEX idx_contracts_hook_risk ON contracts (hook_risk)`,
+			},
+		},
+		down: sqlSteps{
+			"*": {
+				`DROP INDEX idx_contracts_hook_risk`,
+				`DROP INDEX idx_contracts_hooks`,
+				`ALTER TABLE contracts DROP COLUMN hook_risk`,
+				`ALTER TABLE contracts DROP COLUMN hook_code_hash`,
+				`ALTER TABLE contracts DROP COLUMN hook_flags`,
+				`ALTER TABLE contracts DROP COLUMN hooks`,
+			},
+		},
+	},
+	{
+		version: 8,
+		name:    "add known hooks",
+		up: sqlSteps{
+			"postgres": {
+				`CREATE TABLE known_hooks (
+					id bigserial PRIMARY KEY,
+					chain_id bigint NOT NULL,
+					address text NOT NULL DEFAULT '',
+					code_hash text NOT NULL DEFAULT '',
+					label text NOT NULL,
+					name text NOT NULL DEFAULT '',
+					note text NOT NULL DEFAULT '',
+					updated_at timestamptz
+				)`,
+				`CREATE UNIQUE INDEX idx_known_hooks_key ON known_hooks (chain_id, address, code_hash)`,
+				`ALTER TABLE contracts ADD COLUMN hook_label text NOT NULL DEFAULT ''`,
+				`CREATE INDEX idx_contracts_hook_label ON contracts (hook_label)`,
+			},
+			"sqlite": {
+				`CREATE TABLE known_hooks (
+					id integer PRIMARY KEY AUTOINCREMENT,
+					chain_id integer NOT NULL,
+					address text NOT NULL DEFAULT '',
+					code_hash text NOT NULL DEFAULT '',
+					label text NOT NULL,
+					name text NOT NULL DEFAULT '',
+					note text NOT NULL DEFAULT '',
+					updated_at datetime
+				)`,
+				`CREATE UNIQUE INDEX idx_known_hooks_key ON known_hooks (chain_id, address, code_hash)`,
+				`ALTER TABLE contracts ADD COLUMN hook_label text NOT NULL DEFAULT ''`,
+				`CREATE INDEX idx_contracts_hook_label ON contracts (hook_label)`,
+			},
+		},
+		down: sqlSteps{
+			"*": {
+				`DROP INDEX idx_contracts_hook_label`,
+				`ALTER TABLE contracts DROP COLUMN hook_label`,
+				`DROP TABLE known_hooks`,
+			},
+		},
+	},
+	{
+		version: 9,
+		name:    "add V4 pool key, allow a token in several pools",
+		up: sqlSteps{
+			"*": {
+				`DROP INDEX IF EXISTS idx_contracts_address`,
+				`CREATE INDEX idx_contracts_address ON contracts (address)`,
+				`ALTER TABLE contracts ADD COLUMN currency0 text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN currency1 text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN tick_spacing integer NOT NULL DEFAULT 0`,
+				// V4 pools were stored as currency0/currency1, so pools paired
+				// with the native coin had the zero address as their token
+				`UPDATE contracts SET currency0 = address, currency1 = backing_coin_address WHERE exchange = 'UniswapV4'`,
+				`UPDATE contracts SET address = backing_coin_address, backing_coin_address = address
+					WHERE exchange = 'UniswapV4' AND address = '0x0000000000000000000000000000000000000000'`,
+			},
+		},
+		down: sqlSteps{
+			// fails if a token is stored in more than one pool
+			"*": {
+				`ALTER TABLE contracts DROP COLUMN tick_spacing`,
+				`ALTER TABLE contracts DROP COLUMN currency1`,
+				`ALTER TABLE contracts DROP COLUMN currency0`,
+				`DROP INDEX idx_contracts_address`,
+				`CREATE UNIQUE INDEX idx_contracts_address ON contracts (address)`,
+			},
+		},
+	},
+	{
+		version: 10,
+		name:    "add chain ID",
+		up: sqlSteps{
+			"*": {
+				`ALTER TABLE contracts ADD COLUMN chain_id bigint NOT NULL DEFAULT 0`,
+				`CREATE INDEX idx_contracts_chain_id ON contracts (chain_id)`,
+			},
+		},
+		down: sqlSteps{
+			"*": {
+				`DROP INDEX idx_contracts_chain_id`,
+				`ALTER TABLE contracts DROP COLUMN chain_id`,
+			},
+		},
+	},
+	{
+		version: 11,
+		name:    "add Infinity pool parameters",
+		up: sqlSteps{
+			"*": {
+				`ALTER TABLE contracts ADD COLUMN parameters text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN bin_step integer NOT NULL DEFAULT 0`,
+				`ALTER TABLE contracts ADD COLUMN active_id bigint NOT NULL DEFAULT 0`,
+			},
+		},
+		down: sqlSteps{
+			"*": {
+				`ALTER TABLE contracts DROP COLUMN active_id`,
+				`ALTER TABLE contracts DROP COLUMN bin_step`,
+				`ALTER TABLE contracts DROP COLUMN parameters`,
+			},
+		},
+	},
+	{
+		version: 12,
+		name:    "add pool type and stable flag",
+		up: sqlSteps{
+			"*": {
+				`ALTER TABLE contracts ADD COLUMN pool_type text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN stable boolean NOT NULL DEFAULT false`,
+				`CREATE INDEX IF NOT EXISTS idx_contracts_pool_type ON contracts (pool_type)`,
+				`UPDATE contracts SET pool_type = 'v2' WHERE exchange IN ('UniswapV2', 'PancakeSwapV2')`,
+				`UPDATE contracts SET pool_type = 'cl' WHERE exchange IN ('UniswapV3', 'PancakeSwapV3', 'UniswapV4', 'PancakeSwapInfinityCL')`,
+				`UPDATE contracts SET pool_type = 'bin' WHERE exchange = 'PancakeSwapInfinityBin'`,
+			},
+		},
+		down: sqlSteps{
+			"*": {
+				`DROP INDEX IF EXISTS idx_contracts_pool_type`,
+				`ALTER TABLE contracts DROP COLUMN stable`,
+				`ALTER TABLE contracts DROP COLUMN pool_type`,
+			},
+		},
+	},
+	{
+		version: 13,
+		name:    "add pool tokens and amplification",
+		up: sqlSteps{
+			"postgres": {
+				`CREATE TABLE pool_tokens (
+					id bigserial PRIMARY KEY,
+					chain_id bigint NOT NULL,
+					pool_address text NOT NULL,
+					position bigint NOT NULL,
+					token text NOT NULL,
+					weight text NOT NULL DEFAULT ''
+				)`,
+				`CREATE UNIQUE INDEX idx_pool_tokens_pool ON pool_tokens (chain_id, pool_address, position)`,
+				`CREATE INDEX idx_pool_tokens_token ON pool_tokens (token)`,
+				`ALTER TABLE contracts ADD COLUMN amplification bigint NOT NULL DEFAULT 0`,
+			},
+			"sqlite": {
+				`CREATE TABLE pool_tokens (
+					id integer PRIMARY KEY AUTOINCREMENT,
+					chain_id integer NOT NULL,
+					pool_address text NOT NULL,
+					position integer NOT NULL,
+					token text NOT NULL,
+					weight text NOT NULL DEFAULT ''
+				)`,
+				`CREATE UNIQUE INDEX idx_pool_tokens_pool ON pool_tokens (chain_id, pool_address, position)`,
+				`CREATE INDEX idx_pool_tokens_token ON pool_tokens (token)`,
+				`ALTER TABLE contracts ADD COLUMN amplification integer NOT NULL DEFAULT 0`,
+			},
+		},
+		down: sqlSteps{
+			"*": {
+				`ALTER TABLE contracts DROP COLUMN amplification`,
+				`DROP TABLE pool_tokens`,
+			},
+		},
+	},
+	{
+		version: 14,
+		name:    "add token launches",
+		up: sqlSteps{
+			"*": {
+				`ALTER TABLE contracts ADD COLUMN launchpad text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN creator text NOT NULL DEFAULT ''`,
+				`ALTER TABLE contracts ADD COLUMN initial_supply text NOT NULL DEFAULT ''`,
+				`CREATE INDEX idx_contracts_launchpad ON contracts (launchpad)`,
+				`CREATE INDEX idx_contracts_creator ON contracts (creator)`,
+			},
+		},
+		down: sqlSteps{
+			"*": {
+				`DROP INDEX idx_contracts_creator`,
+				`DROP INDEX idx_contracts_launchpad`,
+				`ALTER TABLE contracts DROP COLUMN initial_supply`,
+				`ALTER TABLE contracts DROP COLUMN creator`,
+				`ALTER TABLE contracts DROP COLUMN launchpad`,
+			},
+		},
+	},
+	{
+		version: 15,
+		name:    "orient stored pools against quote coins",
+		// pools stored before they were oriented kept the factory's order.
+		// Pairs are swapped the way Contract.Orient does it, with the quote
+		// coins each chain had at this version. Rows without a chain belong
+		// to the chain their exchange was deployed on then.
+		up: sqlSteps{
+			"*": {
+				`UPDATE contracts SET address = backing_coin_address, backing_coin_address = address
+					WHERE (chain_id = 1 OR (chain_id = 0 AND exchange IN ('UniswapV2', 'UniswapV3'))) AND pool_type <> 'launch' AND backing_coin_address <> ''
+						AND CASE lower(address) WHEN '0x0000000000000000000000000000000000000000' THEN 0 WHEN '0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2' THEN 1 WHEN '0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48' THEN 2 WHEN '0xdac17f958d2ee523a2206206994597c13d831ec7' THEN 3 WHEN '0x6b175474e89094c44da98b954eedeac495271d0f' THEN 4 ELSE 5 END
+							< CASE lower(backing_coin_address) WHEN '0x0000000000000000000000000000000000000000' THEN 0 WHEN '0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2' THEN 1 WHEN '0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48' THEN 2 WHEN '0xdac17f958d2ee523a2206206994597c13d831ec7' THEN 3 WHEN '0x6b175474e89094c44da98b954eedeac495271d0f' THEN 4 ELSE 5 END
+						AND NOT EXISTS (SELECT 1 FROM pool_tokens t WHERE t.chain_id = contracts.chain_id AND t.pool_address = contracts.pool_address)`,
+				`UPDATE contracts SET address = backing_coin_address, backing_coin_address = address
+					WHERE chain_id = 10 AND pool_type <> 'launch' AND backing_coin_address <> ''
+						AND CASE lower(address) WHEN '0x0000000000000000000000000000000000000000' THEN 0 WHEN '0x4200000000000000000000000000000000000006' THEN 1 WHEN '0x0b2c639c533813f4aa9d7837caf62653d097ff85' THEN 2 ELSE 3 END
+							< CASE lower(backing_coin_address) WHEN '0x0000000000000000000000000000000000000000' THEN 0 WHEN '0x4200000000000000000000000000000000000006' THEN 1 WHEN '0x0b2c639c533813f4aa9d7837caf62653d097ff85' THEN 2 ELSE 3 END
+						AND NOT EXISTS (SELECT 1 FROM pool_tokens t WHERE t.chain_id = contracts.chain_id AND t.pool_address = contracts.pool_address)`,
+				`UPDATE contracts SET address = backing_coin_address, backing_coin_address = address
+					WHERE (chain_id = 56 OR (chain_id = 0 AND exchange IN ('PancakeSwapV2', 'PancakeSwapV3', 'UniswapV4'))) AND pool_type <> 'launch' AND backing_coin_address <> ''
+						AND CASE lower(address) WHEN '0x0000000000000000000000000000000000000000' THEN 0 WHEN '0xbb4cdb9cbd36b01bd1cbaebf2de08d9173bc095c' THEN 1 WHEN '0x55d398326f99059ff775485246999027b3197955' THEN 2 WHEN '0x8ac76a51cc950d9822d68b83fe1ad97b32cd580d' THEN 3 WHEN '0xe9e7cea3dedca5984780bafc599bd69add087d56' THEN 4 ELSE 5 END
+							< CASE lower(backing_coin_address) WHEN '0x0000000000000000000000000000000000000000' THEN 0 WHEN '0xbb4cdb9cbd36b01bd1cbaebf2de08d9173bc095c' THEN 1 WHEN '0x55d398326f99059ff775485246999027b3197955' THEN 2 WHEN '0x8ac76a51cc950d9822d68b83fe1ad97b32cd580d' THEN 3 WHEN '0xe9e7cea3dedca5984780bafc599bd69add087d56' THEN 4 ELSE 5 END
+						AND NOT EXISTS (SELECT 1 FROM pool_tokens t WHERE t.chain_id = contracts.chain_id AND t.pool_address = contracts.pool_address)`,
+				`UPDATE contracts SET address = backing_coin_address, backing_coin_address = address
+					WHERE chain_id = 137 AND pool_type <> 'launch' AND backing_coin_address <> ''
+						AND CASE lower(address) WHEN '0x0000000000000000000000000000000000000000' THEN 0 WHEN '0x0d500b1d8e8ef31e21c99d1db9a6444d3adf1270' THEN 1 WHEN '0x3c499c542cef5e3811e1192ce70d8cc03d5c3359' THEN 2 ELSE 3 END
+							< CASE lower(backing_coin_address) WHEN '0x0000000000000000000000000000000000000000' THEN 0 WHEN '0x0d500b1d8e8ef31e21c99d1db9a6444d3adf1270' THEN 1 WHEN '0x3c499c542cef5e3811e1192ce70d8cc03d5c3359' THEN 2 ELSE 3 END
+						AND NOT EXISTS (SELECT 1 FROM pool_tokens t WHERE t.chain_id = contracts.chain_id AND t.pool_address = contracts.pool_address)`,
+				`UPDATE contracts SET address = backing_coin_address, backing_coin_address = address
+					WHERE chain_id = 8453 AND pool_type <> 'launch' AND backing_coin_address <> ''
+						AND CASE lower(address) WHEN '0x0000000000000000000000000000000000000000' THEN 0 WHEN '0x4200000000000000000000000000000000000006' THEN 1 WHEN '0x833589fcd6edb6e08f4c7c32d4f71b54bda02913' THEN 2 ELSE 3 END
+							< CASE lower(backing_coin_address) WHEN '0x0000000000000000000000000000000000000000' THEN 0 WHEN '0x4200000000000000000000000000000000000006' THEN 1 WHEN '0x833589fcd6edb6e08f4c7c32d4f71b54bda02913' THEN 2 ELSE 3 END
+						AND NOT EXISTS (SELECT 1 FROM pool_tokens t WHERE t.chain_id = contracts.chain_id AND t.pool_address = contracts.pool_address)`,
+				`UPDATE contracts SET address = backing_coin_address, backing_coin_address = address
+					WHERE chain_id = 42161 AND pool_type <> 'launch' AND backing_coin_address <> ''
+						AND CASE lower(address) WHEN '0x0000000000000000000000000000000000000000' THEN 0 WHEN '0x82af49447d8a07e3bd95bd0d56f35241523fbab1' THEN 1 WHEN '0xaf88d065e77c8cc2239327c5edb3a432268e5831' THEN 2 WHEN '0xfd086bc7cd5c481dcc9c85ebe478a1c0b69fcbb9' THEN 3 ELSE 4 END
+							< CASE lower(backing_coin_address) WHEN '0x0000000000000000000000000000000000000000' THEN 0 WHEN '0x82af49447d8a07e3bd95bd0d56f35241523fbab1' THEN 1 WHEN '0xaf88d065e77c8cc2239327c5edb3a432268e5831' THEN 2 WHEN '0xfd086bc7cd5c481dcc9c85ebe478a1c0b69fcbb9' THEN 3 ELSE 4 END
+						AND NOT EXISTS (SELECT 1 FROM pool_tokens t WHERE t.chain_id = contracts.chain_id AND t.pool_address = contracts.pool_address)`,
+				`UPDATE contracts SET address = backing_coin_address, backing_coin_address = address
+					WHERE chain_id = 43114 AND pool_type <> 'launch' AND backing_coin_address <> ''
+						AND CASE lower(address) WHEN '0x0000000000000000000000000000000000000000' THEN 0 WHEN '0xb31f66aa3c1e785363f0875a1b74e27b85fd66c7' THEN 1 WHEN '0xb97ef9ef8734c71904d8002f8b6bc66dd9c48a6e' THEN 2 WHEN '0x9702230a8ea53601f5cd2dc00fdbc13d4df4a8c7' THEN 3 ELSE 4 END
+							< CASE lower(backing_coin_address) WHEN '0x0000000000000000000000000000000000000000' THEN 0 WHEN '0xb31f66aa3c1e785363f0875a1b74e27b85fd66c7' THEN 1 WHEN '0xb97ef9ef8734c71904d8002f8b6bc66dd9c48a6e' THEN 2 WHEN '0x9702230a8ea53601f5cd2dc00fdbc13d4df4a8c7' THEN 3 ELSE 4 END
+						AND NOT EXISTS (SELECT 1 FROM pool_tokens t WHERE t.chain_id = contracts.chain_id AND t.pool_address = contracts.pool_address)`,
+			},
+		},
+		// the order before is not known, oriented pools stay oriented
+		down: sqlSteps{"*": {}},
+	},
+}
+
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// schemaMigration is a row of the table recording applied versions.
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// migrationLockID is an arbitrary key for the Postgres advisory lock that keeps
+// replicas from migrating at the same time.
+const migrationLockID = 0x736e697072
+
+// withMigrationLock runs fn while holding the migration lock.
+func (r *gormRepository) withMigrationLock(fn func() error) error {
+	if r.name != "postgres" {
+		// SQLite serialises writers on its own
+		return fn()
+	}
+
+	// advisory locks belong to a session, so pin one connection
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	defer sqlDB.SetMaxOpenConns(0)
+
+	if err := r.db.Exec("SELECT pg_advisory_lock(?)", migrationLockID).Error; err != nil {
+		return err
+	}
+	defer r.db.Exec("SELECT pg_advisory_unlock(?)", migrationLockID)
+
+	return fn()
+}
+
+// schemaVersion returns the highest applied migration, 0 for a fresh database.
+func (r *gormRepository) schemaVersion() (int, error) {
+	err := r.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		name text,
+		applied_at timestamp
+	)`).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = r.db.Model(&schemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// migrateTo applies or reverts migrations until the schema is at target.
+func (r *gormRepository) migrateTo(target int) error {
+	if target < 0 || target > latestSchemaVersion() {
+		return fmt.Errorf("no schema version %d (latest is %d)", target, latestSchemaVersion())
+	}
+
+	return r.withMigrationLock(func() error {
+		current, err := r.schemaVersion()
+		if err != nil {
+			return err
+		}
+
+		if current > latestSchemaVersion() {
+			return fmt.Errorf("database is at version %d, newer than this build knows (%d)", current, latestSchemaVersion())
+		}
+
+		for _, m := range migrations {
+			if m.version > current && m.version <= target {
+				if err := r.apply(m, m.up, true); err != nil {
+					return err
+				}
+			}
+		}
+
+		for i := len(migrations) - 1; i >= 0; i-- {
+			m := migrations[i]
+			if m.version <= current && m.version > target {
+				if err := r.apply(m, m.down, false); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// apply runs one direction of a migration and records it in a transaction.
+func (r *gormRepository) apply(m migration, steps sqlSteps, up bool) error {
+	direction := "down"
+	if up {
+		direction = "up"
+	}
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range steps.forDialect(r.name) {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+
+		if up {
+			return tx.Create(&schemaMigration{Version: m.version, Name: m.name, AppliedAt: time.Now()}).Error
+		}
+		return tx.Delete(&schemaMigration{}, m.version).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d (%s) %s failed: %w", m.version, m.name, direction, err)
+	}
+
+	log.Printf("Migrated %s: %d %s", direction, m.version, m.name)
+	return nil
+}
+
+// checkSchema refuses to run against a database that is missing migrations,
+// unless --migrate asks to apply them.
+func checkSchema(store Repository) {
+	r, ok := store.(*gormRepository)
+	if !ok {
+		return
+	}
+
+	if *autoMigrate {
+		if err := r.migrateTo(latestSchemaVersion()); err != nil {
+			log.Fatalf("Failed to migrate database!\n %v", err)
+		}
+		return
+	}
+
+	version, err := r.schemaVersion()
+	if err != nil {
+		log.Fatalf("Failed to read schema version!\n %v", err)
+	}
+
+	switch {
+	case version < latestSchemaVersion():
+		log.Fatalf("Database schema is at version %d but this build needs %d. Run `snipr migrate` or start with --migrate.", version, latestSchemaVersion())
+	case version > latestSchemaVersion():
+		log.Printf("Warning: database schema is at version %d, newer than this build (%d). Another replica may have been upgraded.", version, latestSchemaVersion())
+	}
+}
+
+// runMigrate implements `snipr migrate [up|down|status]`.
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	to := fs.Int("to", -1, "Target schema version (default: latest for up, one step back for down)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snipr migrate [-to N] [up|down|status]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	store, err := openStore(*storeFlag)
+	if err != nil {
+		log.Fatalf("Failed to connect to database!\n %v", err)
+	}
+	r, ok := store.(*gormRepository)
+	if !ok {
+		log.Fatalf("Store %q has no schema to migrate.", *storeFlag)
+	}
+	defer r.Close()
+
+	current, err := r.schemaVersion()
+	if err != nil {
+		log.Fatalf("Failed to read schema version!\n %v", err)
+	}
+
+	action := fs.Arg(0)
+	if action == "" {
+		action = "up"
+	}
+
+	target := *to
+	switch action {
+	case "up":
+		if target < 0 {
+			target = latestSchemaVersion()
+		}
+		if target < current {
+			log.Fatalf("Target %d is below the current version %d, use down.", target, current)
+		}
+
+	case "down":
+		if target < 0 {
+			target = current - 1
+		}
+		if target > current {
+			log.Fatalf("Target %d is above the current version %d, use up.", target, current)
+		}
+
+	case "status":
+		for _, m := range migrations {
+			state := "pending"
+			if m.version <= current {
+				state = "applied"
+			}
+			fmt.Printf("%3d  %-8s %s\n", m.version, state, m.name)
+		}
+		return
+
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if err := r.migrateTo(target); err != nil {
+		log.Fatalf("Failed to migrate database!\n %v", err)
+	}
+
+	log.Printf("Schema is at version %d", target)
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Multicall3 is deployed at the same address on nearly every EVM chain.
+const multicall3Address = "0xcA11bde05977b3631167028862bE2a173976CA11"
+
+const multicall3ABI = `[{"inputs":[{"components":[{"internalType":"address","name":"target","type":"address"},{"internalType":"bool","name":"allowFailure","type":"bool"},{"internalType":"bytes","name":"callData","type":"bytes"}],"internalType":"struct Multicall3.Call3[]","name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"internalType":"bool","name":"success","type":"bool"},{"internalType":"bytes","name":"returnData","type":"bytes"}],"internalType":"struct Multicall3.Result[]","name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`
+
+// errCallReverted is a call the contract reverted. Like the node's own
+// "execution reverted" it is an rpc.DataError, so ReadPool implementations
+// tell reverts from calls that got no answer the same way with or without
+// the batcher.
+var errCallReverted error = callReverted{}
+
+type callReverted struct{}
+
+func (callReverted) Error() string  { return "call reverted" }
+func (callReverted) ErrorData() any { return nil }
+
+var (
+	metricCallsBatched  = expvar.NewInt("calls_batched")
+	metricCallBatches   = expvar.NewMap("call_batches") // by "multicall" / "rpc_batch"
+	metricCallsReverted = expvar.NewInt("calls_reverted")
+)
+
+// callRequest is a single eth_call against Block, or the latest block when
+// it is nil.
+type callRequest struct {
+	To    common.Address
+	Data  []byte
+	Block *big.Int
+}
+
+type callResult struct {
+	Data []byte
+	Err  error
+}
+
+type pendingCall struct {
+	req  callRequest
+	done chan callResult
+}
+
+type multicall3Call struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type multicall3Result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// callBatcher collects eth_calls made around the same time and sends them as
+// one Multicall3 aggregate3 call, or as a JSON-RPC batch where Multicall3 is
+// not deployed. A failing call only fails its own result.
+type callBatcher struct {
+	gateway  *rpcGateway
+	priority rpcPriority
+	window   time.Duration
+	maxCalls int
+	calls    chan *pendingCall
+
+	multicall    common.Address
+	multicallABI abi.ABI
+
+	// whether Multicall3 is deployed, decided by the first check that got an
+	// answer
+	mu           sync.Mutex
+	checkedCode  bool
+	hasMulticall bool
+}
+
+func newCallBatcher(gateway *rpcGateway, priority rpcPriority, window time.Duration, maxCalls int, multicall string) *callBatcher {
+	parsed, err := abi.JSON(strings.NewReader(multicall3ABI))
+	if err != nil {
+		log.Fatalf("Failed to parse Multicall3 ABI: %v", err)
+	}
+
+	b := &callBatcher{
+		gateway:      gateway,
+		priority:     priority,
+		window:       window,
+		maxCalls:     maxCalls,
+		calls:        make(chan *pendingCall, maxCalls),
+		multicall:    common.HexToAddress(multicall),
+		multicallABI: parsed,
+	}
+
+	go b.loop()
+
+	return b
+}
+
+// Call runs a single call as part of the next batch.
+func (b *callBatcher) Call(ctx context.Context, to common.Address, data []byte) ([]byte, error) {
+	res := b.CallMany(ctx, []callRequest{{To: to, Data: data}})
+	return res[0].Data, res[0].Err
+}
+
+// CallMany runs calls as part of the next batch and returns their results in
+// the same order.
+func (b *callBatcher) CallMany(ctx context.Context, reqs []callRequest) []callResult {
+	pending := make([]*pendingCall, len(reqs))
+	for i, req := range reqs {
+		pending[i] = &pendingCall{req: req, done: make(chan callResult, 1)}
+		select {
+		case b.calls <- pending[i]:
+		case <-ctx.Done():
+			pending[i].done <- callResult{Err: ctx.Err()}
+		}
+	}
+
+	results := make([]callResult, len(reqs))
+	for i, p := range pending {
+		select {
+		case results[i] = <-p.done:
+		case <-ctx.Done():
+			results[i] = callResult{Err: ctx.Err()}
+		}
+	}
+
+	return results
+}
+
+func (b *callBatcher) loop() {
+	for first := range b.calls {
+		batch := []*pendingCall{first}
+		timer := time.NewTimer(b.window)
+
+	collect:
+		for len(batch) < b.maxCalls {
+			select {
+			case p := <-b.calls:
+				batch = append(batch, p)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		go b.execute(batch)
+	}
+}
+
+// execute runs a batch, as one aggregate or JSON-RPC batch per block its
+// calls are made against.
+func (b *callBatcher) execute(batch []*pendingCall) {
+	metricCallsBatched.Add(int64(len(batch)))
+
+	var blocks []*big.Int
+	byBlock := make(map[string][]*pendingCall)
+	for _, p := range batch {
+		key := "latest"
+		if p.req.Block != nil {
+			key = p.req.Block.String()
+		}
+		if _, ok := byBlock[key]; !ok {
+			blocks = append(blocks, p.req.Block)
+		}
+		byBlock[key] = append(byBlock[key], p)
+	}
+
+	for _, block := range blocks {
+		key := "latest"
+		if block != nil {
+			key = block.String()
+		}
+		b.executeAt(byBlock[key], block)
+	}
+}
+
+func (b *callBatcher) executeAt(batch []*pendingCall, block *big.Int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var results []callResult
+	// Multicall3 may not be deployed yet at an old block, the aggregate then
+	// fails and the calls go as a JSON-RPC batch
+	if len(batch) > 1 && b.multicallDeployed(ctx) {
+		var err error
+		results, err = b.aggregate3(ctx, batch, block)
+		if err != nil {
+			// the aggregate itself failed (gas, size), retry the calls one by one
+			log.Printf("Multicall3 batch of %d calls failed, falling back to JSON-RPC batch: %v", len(batch), err)
+			results = nil
+		}
+	}
+	if results == nil {
+		results = b.rpcBatch(ctx, batch, block)
+	}
+
+	for i, p := range batch {
+		if errors.Is(results[i].Err, errCallReverted) {
+			metricCallsReverted.Add(1)
+		}
+		p.done <- results[i]
+	}
+}
+
+// multicallDeployed checks for Multicall3 code until a provider answers. A
+// failed check only sends this batch without it, the next batch checks again.
+func (b *callBatcher) multicallDeployed(ctx context.Context) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.checkedCode {
+		return b.hasMulticall
+	}
+
+	code, err := b.gateway.CodeAt(ctx, b.priority, b.multicall, nil)
+	if err != nil {
+		log.Printf("Error checking for Multicall3 at %s, sending a JSON-RPC batch: %v", b.multicall.Hex(), err)
+		return false
+	}
+
+	b.checkedCode = true
+	b.hasMulticall = len(code) > 0
+	if !b.hasMulticall {
+		log.Printf("Multicall3 not found at %s, falling back to JSON-RPC batches", b.multicall.Hex())
+	}
+	return b.hasMulticall
+}
+
+func (b *callBatcher) aggregate3(ctx context.Context, batch []*pendingCall, block *big.Int) ([]callResult, error) {
+	calls := make([]multicall3Call, len(batch))
+	for i, p := range batch {
+		calls[i] = multicall3Call{Target: p.req.To, AllowFailure: true, CallData: p.req.Data}
+	}
+
+	input, err := b.multicallABI.Pack("aggregate3", calls)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := b.gateway.CallContract(ctx, b.priority, ethereum.CallMsg{To: &b.multicall, Data: input}, block)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded []multicall3Result
+	if err := b.multicallABI.UnpackIntoInterface(&decoded, "aggregate3", out); err != nil {
+		return nil, err
+	}
+	if len(decoded) != len(batch) {
+		return nil, fmt.Errorf("got %d results for %d calls", len(decoded), len(batch))
+	}
+
+	metricCallBatches.Add("multicall", 1)
+
+	results := make([]callResult, len(batch))
+	for i, r := range decoded {
+		if !r.Success {
+			results[i] = callResult{Err: errCallReverted}
+			continue
+		}
+		results[i] = callResult{Data: r.ReturnData}
+	}
+
+	return results, nil
+}
+
+func (b *callBatcher) rpcBatch(ctx context.Context, batch []*pendingCall, block *big.Int) []callResult {
+	blockArg := "latest"
+	if block != nil {
+		blockArg = hexutil.EncodeBig(block)
+	}
+
+	outs := make([]hexutil.Bytes, len(batch))
+	elems := make([]rpc.BatchElem, len(batch))
+	for i, p := range batch {
+		elems[i] = rpc.BatchElem{
+			Method: "eth_call",
+			Args: []any{
+				map[string]any{"to": p.req.To, "data": hexutil.Bytes(p.req.Data)},
+				blockArg,
+			},
+			Result: &outs[i],
+		}
+	}
+
+	metricCallBatches.Add("rpc_batch", 1)
+
+	results := make([]callResult, len(batch))
+	if err := b.gateway.BatchCall(ctx, b.priority, "eth_call", elems); err != nil {
+		for i := range results {
+			results[i] = callResult{Err: err}
+		}
+		return results
+	}
+
+	for i, elem := range elems {
+		if elem.Error != nil {
+			var dataErr rpc.DataError
+			if errors.As(elem.Error, &dataErr) {
+				// execution reverted
+				results[i] = callResult{Err: errCallReverted}
+				continue
+			}
+			results[i] = callResult{Err: elem.Error}
+			continue
+		}
+		results[i] = callResult{Data: outs[i]}
+	}
+
+	return results
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+
+	"snipr/schemas"
+)
+
+// pollForPools follows every factory with eth_getLogs over HTTP instead of
+// subscriptions, for providers without WebSocket support or with unreliable
+// subscriptions. With --backfill it starts at the block the earliest factory
+// was deployed in and catches up --poll_max_range blocks at a time.
+func pollForPools(exchanges []*schemas.Exchange, wg *sync.WaitGroup, gateway *rpcGateway, enricher *enricher) {
+	defer wg.Done()
+
+	router := newLogRouter(exchanges, gateway, enricher)
+	if len(router.routes) == 0 {
+		return
+	}
+	query := router.query
+
+	merger := newLogMerger(router.name, nil, 0, router.handle)
+
+	// main refuses --backfill on chains without a start block
+	var next uint64
+	if *backfill {
+		next = router.startBlock
+		log.Printf("Backfilling %s from block %d", router.name, next)
+	}
+
+	caughtUp := !*backfill
+	for {
+		// blocks behind the head are backfill, live requests go first
+		priority := priorityLive
+		if !caughtUp {
+			priority = priorityBackfill
+		}
+
+		next, caughtUp = pollOnce(gateway, query, merger, next, priority)
+		if caughtUp {
+			time.Sleep(*pollInterval)
+		}
+	}
+}
+
+// pollOnce fetches the logs from block next up to the head, at most
+// --poll_max_range blocks of them, and returns the block the next poll starts
+// at and whether the head was reached. A next of 0 starts at the head. Its
+// requests are made at priority.
+//
+// Head and logs come from the same provider, so one that is behind the others
+// is never asked for blocks it does not have yet.
+func pollOnce(gateway *rpcGateway, query ethereum.FilterQuery, merger *logMerger, next uint64, priority rpcPriority) (uint64, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, p := range gateway.pollCandidates() {
+		head, err := gateway.BlockNumberOn(ctx, priority, p)
+		if err != nil {
+			log.Printf("Failed to poll head on %s: %v", p.name, err)
+			continue
+		}
+
+		if next == 0 {
+			next = head
+		}
+		if next > head {
+			return next, true
+		}
+
+		to := min(head, next+max(*pollMaxRange, 1)-1)
+		q := query
+		q.FromBlock = bigUint(next)
+		q.ToBlock = bigUint(to)
+
+		logs, err := gateway.FilterLogsOn(ctx, priority, p, q)
+		if err != nil {
+			log.Printf("Failed to poll logs for blocks %d-%d on %s: %v", next, to, p.name, err)
+			continue
+		}
+
+		found := merger.addAll(p.name, logs)
+		if *verbose { log.Printf("Polled blocks %d-%d on %s, %d new logs", next, to, p.name, found) }
+
+		return to + 1, to == head
+	}
+
+	return next, true
+}
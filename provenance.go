@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"snipr/schemas"
+)
+
+// blockTimes caches block timestamps by hash, since a burst of pools usually
+// lands in the same few blocks.
+type blockTimes struct {
+	mu    sync.Mutex
+	times map[common.Hash]time.Time
+	order []common.Hash
+}
+
+const blockTimesSize = 256
+
+var headerTimes = &blockTimes{times: make(map[common.Hash]time.Time)}
+
+func (b *blockTimes) get(ctx context.Context, gateway *rpcGateway, hash common.Hash) (time.Time, error) {
+	b.mu.Lock()
+	t, ok := b.times[hash]
+	b.mu.Unlock()
+	if ok {
+		return t, nil
+	}
+
+	header, err := gateway.HeaderByHash(ctx, priorityLive, hash)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t = time.Unix(int64(header.Time), 0).UTC()
+	b.put(hash, t)
+
+	return t, nil
+}
+
+// put records a timestamp that is already known, e.g. from a new head.
+func (b *blockTimes) put(hash common.Hash, t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.times[hash]; !ok {
+		b.times[hash] = t
+		b.order = append(b.order, hash)
+		if len(b.order) > blockTimesSize {
+			delete(b.times, b.order[0])
+			b.order = b.order[1:]
+		}
+	}
+}
+
+// fillProvenance records the log position on the contract and looks up the
+// block timestamp and transaction sender. Lookups that fail are logged and
+// left empty rather than dropping the contract.
+func fillProvenance(gateway *rpcGateway, c *schemas.Contract, vLog types.Log, receivedAt time.Time) {
+	c.SetLog(vLog, receivedAt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	blockTime, err := headerTimes.get(ctx, gateway, vLog.BlockHash)
+	if err != nil {
+		log.Printf("Error fetching block %s for %s: %v", vLog.BlockHash.Hex(), c.Address, err)
+	} else {
+		c.BlockTimestamp = blockTime
+		if *verbose { log.Printf("Detected %s %s after its block was produced (tx %s)", c.Address, c.DetectionLatency(), c.TxHash) }
+	}
+
+	sender, err := gateway.TransactionFrom(ctx, priorityLive, vLog.TxHash)
+	if err != nil {
+		log.Printf("Error fetching transaction %s for %s: %v", vLog.TxHash.Hex(), c.Address, err)
+		return
+	}
+	c.TxSender = sender.Hex()
+}
+
+// readPool reads what the event of a contract left out as it was at the
+// block of the event, batched with the other reads of the chain. Calls the
+// providers failed are retried a few times, the error of the last attempt is
+// returned. Fields are left empty when the calls fail, e.g. on a node that has
+// pruned the state of old blocks.
+func readPool(calls *callBatcher, exchange *schemas.Exchange, c *schemas.Contract, vLog types.Log) error {
+	block := new(big.Int).SetUint64(vLog.BlockNumber)
+
+	var err error
+	for attempt := 1; attempt <= 3; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		call := func(to common.Address, data []byte) ([]byte, error) {
+			res := calls.CallMany(ctx, []callRequest{{To: to, Data: data, Block: block}})
+			return res[0].Data, res[0].Err
+		}
+		err = exchange.ReadPool(call, c)
+		cancel()
+		if err == nil || !providerFailed(err) {
+			break
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+	if err != nil {
+		log.Printf("Error reading the %s pool of %s in tx %s: %v", exchange.Name, c.Address, vLog.TxHash.Hex(), err)
+	}
+	return err
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// errNoProvider is returned when every provider failed or none can serve the
+// request (e.g. a subscription with only HTTP endpoints configured).
+var errNoProvider = errors.New("no RPC provider available")
+
+// provider is one RPC endpoint. Providers are preferred by their score, the
+// configured order breaking ties; a provider that fails health checks is
+// skipped until it recovers.
+type provider struct {
+	name  string
+	url   string
+	ws    bool
+	index int
+
+	budget  *tokenBucket
+	methods map[string]*tokenBucket
+
+	mu        sync.Mutex
+	client    *ethclient.Client
+	latency   time.Duration // moving average of successful requests
+	errorRate float64       // moving average, 1 means every request failed
+	head      uint64
+	checkErr  error
+	lagging   bool
+}
+
+func newProvider(index int, rawURL string, cuPerSecond float64, methodLimits map[string]float64) *provider {
+	p := &provider{
+		name:    providerName(rawURL),
+		url:     rawURL,
+		ws:      strings.HasPrefix(rawURL, "ws"),
+		index:   index,
+		budget:  newTokenBucket(cuPerSecond, cuPerSecond),
+		methods: make(map[string]*tokenBucket),
+	}
+
+	for method, rate := range methodLimits {
+		p.methods[method] = newTokenBucket(rate, rate)
+	}
+
+	return p
+}
+
+// dial connects the provider if it is not connected yet.
+func (p *provider) dial(ctx context.Context) (*ethclient.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	client, err := ethclient.DialContext(ctx, p.url)
+	if err != nil {
+		p.checkErr = err
+		return nil, err
+	}
+	p.client = client
+	return client, nil
+}
+
+func (p *provider) getClient() *ethclient.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.client
+}
+
+// observe folds the outcome of a request into the provider's score.
+func (p *provider) observe(latency time.Duration, err error) {
+	const weight = 0.2
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	failed := 0.0
+	if err != nil {
+		failed = 1
+	} else if p.latency == 0 {
+		p.latency = latency
+	} else {
+		p.latency = time.Duration(float64(p.latency)*(1-weight) + float64(latency)*weight)
+	}
+	p.errorRate = p.errorRate*(1-weight) + failed*weight
+}
+
+// score is lower for better providers: latency in milliseconds, inflated by
+// the error rate.
+func (p *provider) score() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.scoreLocked()
+}
+
+func (p *provider) scoreLocked() float64 {
+	return float64(p.latency.Milliseconds()+1) * (1 + 20*p.errorRate)
+}
+
+func (p *provider) healthy() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.client != nil &&
+		p.checkErr == nil &&
+		!p.lagging &&
+		p.errorRate < *providerMaxErrorRate &&
+		p.latency < *providerMaxLatency
+}
+
+// providerFailed reports whether err says something about the provider rather
+// than the request, so the request is worth retrying elsewhere. Only broken
+// connections, timeouts and overload count; a request the node answered with
+// an error, e.g. a revert, a missing transaction or invalid params, would fail
+// the same way anywhere.
+func providerFailed(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	// no usable connection, or it broke while waiting for the answer
+	if errors.Is(err, errNoProvider) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, rpc.ErrClientQuit) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// the provider is down or rate limiting us
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.ErrorCode() == rpcLimitExceeded
+	}
+
+	return false
+}
+
+// rpcLimitExceeded is the JSON-RPC error code providers rate limit with.
+const rpcLimitExceeded = -32005
+
+// loadProviders dials the comma separated WebSocket and HTTP endpoints. Only
+// fails if none of them can be reached; the rest are retried by the health
+// checks.
+func loadProviders(wssURLs, httpURLs string, cuPerSecond float64, methodLimits map[string]float64) ([]*provider, *big.Int, error) {
+	var providers []*provider
+	names := make(map[string]int)
+	for _, list := range []string{wssURLs, httpURLs} {
+		for _, u := range strings.Split(list, ",") {
+			u = strings.TrimSpace(u)
+			if u == "" {
+				continue
+			}
+
+			p := newProvider(len(providers), u, cuPerSecond, methodLimits)
+			// several keys on the same host still need telling apart
+			if names[p.name]++; names[p.name] > 1 {
+				p.name = fmt.Sprintf("%s#%d", p.name, names[p.name])
+			}
+			providers = append(providers, p)
+		}
+	}
+
+	var chainID *big.Int
+	for _, p := range providers {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		client, err := p.dial(ctx)
+		if err != nil {
+			cancel()
+			log.Printf("Failed to connect to %s: %v", p.name, err)
+			continue
+		}
+
+		id, err := client.ChainID(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to get chain ID from %s: %v", p.name, err)
+			p.mu.Lock()
+			p.checkErr = err
+			p.mu.Unlock()
+			continue
+		}
+
+		if chainID == nil {
+			chainID = id
+		} else if chainID.Cmp(id) != 0 {
+			return nil, nil, fmt.Errorf("%s is on chain %s, expected %s", p.name, id, chainID)
+		}
+
+		log.Printf("Connected to %s (chain %s)", p.name, id)
+	}
+
+	if chainID == nil {
+		return nil, nil, errNoProvider
+	}
+
+	return providers, chainID, nil
+}
+
+// healthCheck polls every provider's head block and marks the slow, failing
+// and lagging ones unhealthy.
+func (g *rpcGateway) healthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var wg sync.WaitGroup
+		for _, p := range g.providers {
+			wg.Add(1)
+			go func(p *provider) {
+				defer wg.Done()
+				g.checkProvider(p)
+			}(p)
+		}
+		wg.Wait()
+
+		var best uint64
+		for _, p := range g.providers {
+			p.mu.Lock()
+			if p.checkErr == nil && p.head > best {
+				best = p.head
+			}
+			p.mu.Unlock()
+		}
+
+		for _, p := range g.providers {
+			p.mu.Lock()
+			lagging := p.head+*providerMaxLag < best
+			if lagging && !p.lagging {
+				log.Printf("Provider %s is %d blocks behind", p.name, best-p.head)
+			}
+			p.lagging = lagging
+			p.mu.Unlock()
+		}
+
+		g.updatePreferred()
+	}
+}
+
+// checkProvider fetches the provider's head and chain ID. A provider whose
+// endpoint was pointed at another chain since it was loaded is unhealthy until
+// it is back on the gateway's chain.
+func (g *rpcGateway) checkProvider(p *provider) {
+	ctx, cancel := context.WithTimeout(context.Background(), *providerMaxLatency*2)
+	defer cancel()
+
+	wasHealthy := p.healthy()
+
+	client, err := p.dial(ctx)
+	var head uint64
+	if err == nil {
+		start := time.Now()
+		head, err = client.BlockNumber(ctx)
+		p.observe(time.Since(start), err)
+	}
+	if err == nil {
+		var id *big.Int
+		if id, err = client.ChainID(ctx); err == nil && id.Cmp(g.chainID) != 0 {
+			err = fmt.Errorf("on chain %s, expected %s", id, g.chainID)
+		}
+	}
+
+	p.mu.Lock()
+	p.checkErr = err
+	if err == nil {
+		p.head = head
+	}
+	p.mu.Unlock()
+
+	switch isHealthy := p.healthy(); {
+	case wasHealthy && !isHealthy:
+		log.Printf("Provider %s is unhealthy (score %.0f): %v", p.name, p.score(), err)
+	case !wasHealthy && isHealthy:
+		log.Printf("Provider %s recovered (score %.0f)", p.name, p.score())
+	}
+}
+
+// candidates lists providers to try in order: healthy ones by score, then
+// unhealthy ones by score as a last resort. Equal scores keep the configured
+// order.
+func (g *rpcGateway) candidates(needWS bool) []*provider {
+	var healthy, unhealthy []*provider
+	for _, p := range g.providers {
+		if needWS && !p.ws {
+			continue
+		}
+		if p.healthy() {
+			healthy = append(healthy, p)
+		} else if p.getClient() != nil {
+			unhealthy = append(unhealthy, p)
+		}
+	}
+
+	byScore := func(providers []*provider) {
+		scores := make(map[*provider]float64, len(providers))
+		for _, p := range providers {
+			scores[p] = p.score()
+		}
+		sort.SliceStable(providers, func(i, j int) bool {
+			return scores[providers[i]] < scores[providers[j]]
+		})
+	}
+	byScore(healthy)
+	byScore(unhealthy)
+
+	return append(healthy, unhealthy...)
+}
+
+// pollCandidates is candidates with HTTP providers ahead of WebSocket ones,
+// which are better left to subscriptions.
+func (g *rpcGateway) pollCandidates() []*provider {
+	c := g.candidates(false)
+	sort.SliceStable(c, func(i, j int) bool {
+		return !c[i].ws && c[j].ws
+	})
+	return c
+}
+
+// preferredMargin is how much better than the preferred provider another one
+// has to score before subscriptions move to it, so they do not follow every
+// swing in latency.
+const preferredMargin = 1.5
+
+// updatePreferred wakes up subscribers when the provider they should be
+// subscribed to changes, e.g. when the current one turns unhealthy or another
+// one is much faster.
+func (g *rpcGateway) updatePreferred() {
+	var preferred *provider
+	c := g.candidates(true)
+	if len(c) > 0 {
+		preferred = c[0]
+	}
+
+	g.prefMu.Lock()
+	defer g.prefMu.Unlock()
+
+	if current := g.preferred; current != nil && preferred != nil && current != preferred &&
+		current.healthy() && current.score() <= preferred.score()*preferredMargin {
+		preferred = current
+	}
+
+	if preferred == g.preferred {
+		return
+	}
+
+	if preferred != nil {
+		log.Printf("Preferred subscription provider is now %s", preferred.name)
+	}
+	g.preferred = preferred
+	close(g.prefChanged)
+	g.prefChanged = make(chan struct{})
+}
+
+// preferredChanged is closed the next time the preferred subscription
+// provider changes.
+func (g *rpcGateway) preferredChanged() <-chan struct{} {
+	g.prefMu.Lock()
+	defer g.prefMu.Unlock()
+	return g.prefChanged
+}
+
+// preferredName is the provider new subscriptions should go to, empty if
+// there is none.
+func (g *rpcGateway) preferredName() string {
+	g.prefMu.Lock()
+	defer g.prefMu.Unlock()
+	if g.preferred == nil {
+		return ""
+	}
+	return g.preferred.name
+}
+
+// gateways are every chain's gateway, listed together under rpc_providers.
+var (
+	gatewaysMu sync.Mutex
+	gateways   []*rpcGateway
+)
+
+func (g *rpcGateway) publishProviderMetrics() {
+	gatewaysMu.Lock()
+	defer gatewaysMu.Unlock()
+
+	gateways = append(gateways, g)
+	if len(gateways) > 1 {
+		return
+	}
+
+	expvar.Publish("rpc_providers", expvar.Func(func() any {
+		gatewaysMu.Lock()
+		defer gatewaysMu.Unlock()
+
+		var stats []map[string]any
+		for _, g := range gateways {
+			for _, p := range g.providers {
+				healthy := p.healthy()
+				p.mu.Lock()
+				stats = append(stats, map[string]any{
+					"chain":      g.chainID.Uint64(),
+					"name":       p.name,
+					"healthy":    healthy,
+					"latency_ms": p.latency.Milliseconds(),
+					"error_rate": p.errorRate,
+					"score":      p.scoreLocked(),
+					"head":       p.head,
+				})
+				p.mu.Unlock()
+			}
+		}
+		return stats
+	}))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckProviderChainID(t *testing.T) {
+	node := &fakeNode{head: 100}
+	gateway, providers := newFakeGateway(t, node)
+	p := providers[0]
+
+	gateway.checkProvider(p)
+	if !p.healthy() {
+		t.Fatalf("provider on the gateway's chain is unhealthy: %v", p.checkErr)
+	}
+
+	// the endpoint now serves another chain
+	node.mu.Lock()
+	node.chainID = 56
+	node.mu.Unlock()
+	gateway.checkProvider(p)
+	if p.healthy() {
+		t.Error("provider on another chain is still healthy")
+	}
+
+	node.mu.Lock()
+	node.chainID = 1
+	node.mu.Unlock()
+	gateway.checkProvider(p)
+	if !p.healthy() {
+		t.Errorf("provider back on the gateway's chain did not recover: %v", p.checkErr)
+	}
+}
+
+func TestCandidatesByScore(t *testing.T) {
+	gateway, providers := newFakeGateway(t, &fakeNode{}, &fakeNode{}, &fakeNode{}, &fakeNode{})
+	a, b, c, d := providers[0], providers[1], providers[2], providers[3]
+	a.latency = 300 * time.Millisecond
+	b.latency = 50 * time.Millisecond
+	c.latency = 300 * time.Millisecond
+	d.latency = 10 * time.Millisecond
+	d.lagging = true
+
+	got := gateway.candidates(false)
+	want := []*provider{b, a, c, d} // healthy by score, ties in configured order, then unhealthy
+	for i := range want {
+		if got[i] != want[i] {
+			names := make([]string, len(got))
+			for j, p := range got {
+				names[j] = p.name
+			}
+			t.Fatalf("candidates are %v, expected b a c d", names)
+		}
+	}
+}
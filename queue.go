@@ -0,0 +1,313 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"snipr/schemas"
+)
+
+// backend is a destination the write queue delivers batches to.
+type backend struct {
+	name  string
+	write func([]*schemas.Contract) error
+	spool *spool
+
+	// revert removes the contracts of reorged blocks, nil if the backend
+	// cannot
+	revert func(chainID uint64, blockHashes []string) (int64, error)
+}
+
+// writeQueue buffers discovered contracts between the listeners and the
+// database. Once the buffer is full, push blocks so a slow database slows the
+// listeners down instead of piling up goroutines.
+type writeQueue struct {
+	items chan *schemas.Contract
+	quit  chan struct{}
+	wg    sync.WaitGroup
+
+	batchSize     int
+	batchInterval time.Duration
+	retries       int
+
+	backends []*backend
+}
+
+func newWriteQueue(size, workers, batchSize int, batchInterval time.Duration, retries int, backends []*backend) *writeQueue {
+	if retries < 1 {
+		retries = 1
+	}
+
+	q := &writeQueue{
+		items:         make(chan *schemas.Contract, size),
+		quit:          make(chan struct{}),
+		batchSize:     batchSize,
+		batchInterval: batchInterval,
+		retries:       retries,
+		backends:      backends,
+	}
+
+	expvar.Publish("write_queue_depth", expvar.Func(func() any { return len(q.items) }))
+	expvar.Publish("write_queue_capacity", expvar.Func(func() any { return cap(q.items) }))
+
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	for _, b := range backends {
+		if b.spool != nil {
+			go b.spool.replayLoop(*spoolReplayInterval, batchSize, b.write, q.quit)
+		}
+	}
+
+	return q
+}
+
+// push hands a contract to the workers, blocking while the queue is full.
+func (q *writeQueue) push(c *schemas.Contract) {
+	if len(q.backends) == 0 {
+		return
+	}
+
+	select {
+	case q.items <- c:
+		return
+	default:
+	}
+
+	metricQueueBlocked.Add(1)
+	if *verbose { log.Printf("Write queue full (%d), waiting to push %s", cap(q.items), c.Address) }
+
+	select {
+	case q.items <- c:
+	case <-q.quit:
+		log.Printf("Write queue closed, dropping %s", c.Address)
+	}
+}
+
+// close stops the workers after they flushed what is already queued.
+func (q *writeQueue) close() {
+	close(q.quit)
+	q.wg.Wait()
+}
+
+func (q *writeQueue) work() {
+	defer q.wg.Done()
+
+	batch := make([]*schemas.Contract, 0, q.batchSize)
+	ticker := time.NewTicker(q.batchInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		q.write(batch)
+		batch = make([]*schemas.Contract, 0, q.batchSize)
+	}
+
+	for {
+		select {
+		case c := <-q.items:
+			batch = append(batch, c)
+			if len(batch) >= q.batchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+
+		case <-q.quit:
+			// drain whatever is left before exiting
+			for {
+				select {
+				case c := <-q.items:
+					batch = append(batch, c)
+					if len(batch) >= q.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (q *writeQueue) write(batch []*schemas.Contract) {
+	for _, b := range q.backends {
+		// keep the original order while older batches are still spooled
+		if b.spool != nil && b.spool.pending() {
+			q.spill(b, batch)
+			continue
+		}
+
+		err := q.retry(b.name, func() error { return b.write(batch) })
+		if err != nil {
+			log.Printf("Giving up on %d contracts for %s: %v", len(batch), b.name, err)
+			q.spill(b, batch)
+			continue
+		}
+
+		metricWritten.Add(b.name, int64(len(batch)))
+		if *verbose { log.Printf("Pushed %d contracts to %s", len(batch), b.name) }
+	}
+}
+
+// spill saves a batch the backend did not take, or drops it if there is no
+// spool or the spool is full.
+func (q *writeQueue) spill(b *backend, batch []*schemas.Contract) {
+	if b.spool == nil {
+		metricFailed.Add(b.name, int64(len(batch)))
+		return
+	}
+
+	if err := b.spool.append(batch); err != nil {
+		metricFailed.Add(b.name, int64(len(batch)))
+		log.Printf("Error spooling %d contracts for %s, dropping them: %v", len(batch), b.name, err)
+		return
+	}
+
+	if *verbose { log.Printf("Spooled %d contracts for %s", len(batch), b.name) }
+}
+
+// retry runs fn until it succeeds or the attempts run out, doubling the wait
+// between attempts.
+func (q *writeQueue) retry(backend string, fn func() error) error {
+	backoff := 500 * time.Millisecond
+	const maxBackoff = 30 * time.Second
+
+	var err error
+	for attempt := 1; attempt <= q.retries; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		if attempt == q.retries {
+			break
+		}
+
+		metricWriteRetries.Add(1)
+		log.Printf("Error writing to %s (attempt %d/%d): %v. Retrying in %s...", backend, attempt, q.retries, err, backoff)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+
+	return err
+}
+
+// blockWriter writes the contracts of a chain's blocks with --ingest=blocks.
+// Blocks are written in the order they were followed, each as one batch, and
+// the contracts of reorged blocks are removed before the blocks replacing
+// them are written.
+type blockWriter struct {
+	name    string
+	chainID uint64
+	tickets chan *blockTicket
+}
+
+func (q *writeQueue) blockWriter(name string, chainID uint64) *blockWriter {
+	w := &blockWriter{
+		name:    name,
+		chainID: chainID,
+		tickets: make(chan *blockTicket, reorgDepth),
+	}
+
+	q.wg.Add(1)
+	go q.writeBlocks(w)
+
+	return w
+}
+
+// push hands a ticket to the writer, blocking while it is behind.
+func (w *blockWriter) push(t *blockTicket) {
+	w.tickets <- t
+}
+
+func (q *writeQueue) writeBlocks(w *blockWriter) {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case t := <-w.tickets:
+			q.writeBlock(w, t)
+
+		case <-q.quit:
+			for {
+				select {
+				case t := <-w.tickets:
+					q.writeBlock(w, t)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeBlock waits for the contracts of a block and writes them, then marks
+// the block complete.
+func (q *writeQueue) writeBlock(w *blockWriter, t *blockTicket) {
+	if t.batch == nil {
+		q.revert(w, t.reverted)
+		return
+	}
+
+	t.pending.Wait()
+
+	// in the order of their logs, as they were in the block
+	sort.Slice(t.contracts, func(i, j int) bool { return t.contracts[i].LogIndex < t.contracts[j].LogIndex })
+	if len(t.contracts) > 0 {
+		q.write(t.contracts)
+	}
+
+	if t.abandoned {
+		log.Printf("Block %d on %s is incomplete, some of its contracts were dropped on shutdown", t.batch.Number, w.name)
+		return
+	}
+
+	metricBlocksComplete.Add(1)
+	last := new(expvar.Int)
+	last.Set(int64(t.batch.Number))
+	metricLastBlock.Set(w.name, last)
+	if *verbose { log.Printf("Block %d complete on %s, %d factory logs, %d contracts written", t.batch.Number, w.name, len(t.batch.Logs), len(t.contracts)) }
+}
+
+// revert removes the contracts of reorged blocks from every backend that can.
+// Contracts still in a spool are not, they are written once it is replayed.
+func (q *writeQueue) revert(w *blockWriter, blocks []blockRef) {
+	hashes := make([]string, len(blocks))
+	for i, b := range blocks {
+		hashes[i] = b.hash.Hex()
+	}
+
+	for _, b := range q.backends {
+		if b.revert == nil {
+			continue
+		}
+
+		var removed int64
+		err := q.retry(b.name, func() (err error) {
+			removed, err = b.revert(w.chainID, hashes)
+			return err
+		})
+		if err != nil {
+			log.Printf("Error removing the contracts of %d reorged blocks on %s from %s: %v", len(blocks), w.name, b.name, err)
+			continue
+		}
+
+		metricReverted.Add(b.name, removed)
+		if removed > 0 || *verbose {
+			log.Printf("Removed %d contracts of reorged blocks %d-%d on %s from %s", removed, blocks[0].number, blocks[len(blocks)-1].number, w.name, b.name)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// gapChunk is the block range of a single eth_getLogs request when filling
+// gaps, well below the limits most providers enforce.
+const gapChunk = 1000
+
+// reconnectMargin is how far back of the last block a subscription covered a
+// gap check starts, to cover logs that were in flight when it dropped.
+const reconnectMargin = 5
+
+var (
+	metricLogsSingleProvider = expvar.NewMap("logs_single_provider") // by the provider that delivered it
+	metricLogsMissed         = expvar.NewMap("logs_missed")          // by the provider that missed it
+	metricLogsFromGapCheck   = expvar.NewInt("logs_from_gap_check")
+)
+
+type logKey struct {
+	BlockHash common.Hash
+	TxHash    common.Hash
+	Index     uint
+}
+
+type seenLog struct {
+	block     uint64
+	providers map[string]bool
+}
+
+// logMerger passes each log on exactly once no matter how many providers or
+// gap checks deliver it. With more than one member it also reports logs that
+// not every member delivered within the window.
+type logMerger struct {
+	name    string
+	members []string
+	window  time.Duration
+	handle  func(vLog types.Log, receivedAt time.Time)
+
+	mu   sync.Mutex
+	seen map[logKey]*seenLog
+	head uint64
+	adds int
+}
+
+func newLogMerger(name string, members []string, window time.Duration, handle func(types.Log, time.Time)) *logMerger {
+	return &logMerger{
+		name:    name,
+		members: members,
+		window:  window,
+		handle:  handle,
+		seen:    make(map[logKey]*seenLog),
+	}
+}
+
+// add records that provider delivered vLog and hands it on the first time.
+func (m *logMerger) add(provider string, vLog types.Log) bool {
+	if vLog.Removed {
+		// reorged out, the replacement log arrives separately
+		return false
+	}
+
+	receivedAt := time.Now().UTC()
+	key := logKey{BlockHash: vLog.BlockHash, TxHash: vLog.TxHash, Index: vLog.Index}
+
+	m.mu.Lock()
+	s, ok := m.seen[key]
+	if !ok {
+		s = &seenLog{block: vLog.BlockNumber, providers: make(map[string]bool)}
+		m.seen[key] = s
+		m.head = max(m.head, vLog.BlockNumber)
+	}
+	s.providers[provider] = true
+
+	if m.adds++; m.adds%1000 == 0 {
+		m.prune()
+	}
+	m.mu.Unlock()
+
+	if ok {
+		return false
+	}
+
+	if len(m.members) > 1 {
+		time.AfterFunc(m.window, func() { m.check(key) })
+	}
+	m.handle(vLog, receivedAt)
+
+	return true
+}
+
+// prune forgets logs far behind the newest one. Callers hold m.mu.
+func (m *logMerger) prune() {
+	const keepBlocks = 10000
+	for key, s := range m.seen {
+		if s.block+keepBlocks < m.head {
+			delete(m.seen, key)
+		}
+	}
+}
+
+// check reports the members that did not deliver a log.
+func (m *logMerger) check(key logKey) {
+	m.mu.Lock()
+	s, ok := m.seen[key]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+
+	var delivered, missed []string
+	for _, member := range m.members {
+		if s.providers[member] {
+			delivered = append(delivered, member)
+		} else {
+			missed = append(missed, member)
+		}
+	}
+	m.mu.Unlock()
+
+	if len(missed) == 0 {
+		return
+	}
+
+	for _, member := range missed {
+		metricLogsMissed.Add(member, 1)
+	}
+	if len(delivered) == 1 {
+		metricLogsSingleProvider.Add(delivered[0], 1)
+	}
+
+	log.Printf("Quorum %s: log %d of tx %s in block %d delivered by %s, missed by %s",
+		m.name, key.Index, key.TxHash.Hex(), s.block, strings.Join(delivered, ", "), strings.Join(missed, ", "))
+}
+
+// fillGap fetches logs matching query from block from up to the current head
+// and merges them. With providers set every one of them is asked, otherwise
+// whichever provider the gateway picks.
+func (m *logMerger) fillGap(gateway *rpcGateway, providers []*provider, query ethereum.FilterQuery, from uint64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	head, err := gateway.BlockNumber(ctx, priorityLive)
+	if err != nil {
+		log.Printf("Gap check for %s failed to get head: %v", m.name, err)
+		return
+	}
+	if from == 0 || from > head {
+		return
+	}
+	if head-from > *gapMaxBlocks {
+		log.Printf("Gap check for %s spans %d blocks, only checking the last %d", m.name, head-from, *gapMaxBlocks)
+		from = head - *gapMaxBlocks
+	}
+
+	found := 0
+	for start := from; start <= head; start += gapChunk {
+		q := query
+		q.FromBlock = bigUint(start)
+		q.ToBlock = bigUint(min(start+gapChunk-1, head))
+
+		if len(providers) == 0 {
+			logs, err := gateway.FilterLogs(ctx, priorityLive, q)
+			if err != nil {
+				log.Printf("Gap check for %s failed: %v", m.name, err)
+				return
+			}
+			found += m.addAll("gap-check", logs)
+			continue
+		}
+
+		for _, p := range providers {
+			logs, err := gateway.FilterLogsOn(ctx, priorityLive, p, q)
+			if err != nil {
+				log.Printf("Gap check for %s on %s failed: %v", m.name, p.name, err)
+				continue
+			}
+			found += m.addAll(p.name, logs)
+		}
+	}
+
+	metricLogsFromGapCheck.Add(int64(found))
+	if found > 0 || *verbose {
+		log.Printf("Gap check for %s over blocks %d-%d recovered %d missed logs", m.name, from, head, found)
+	}
+}
+
+func (m *logMerger) addAll(provider string, logs []types.Log) int {
+	// hand logs on in chain order
+	sort.Slice(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
+
+	found := 0
+	for _, vLog := range logs {
+		if m.add(provider, vLog) {
+			found++
+		}
+	}
+	return found
+}
+
+// subscriptionCursor is the newest block a log subscription is known to have
+// covered: the head when it was made, or the block of a later log it
+// delivered. A gap check after the subscription drops starts there.
+type subscriptionCursor struct {
+	name  string
+	block uint64
+}
+
+// subscribed moves the cursor to the head once a new subscription is up. The
+// cursor stays where it was if the head cannot be fetched, so the next gap
+// check covers more rather than less.
+func (c *subscriptionCursor) subscribed(gateway *rpcGateway) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	head, err := gateway.BlockNumber(ctx, priorityLive)
+	if err != nil {
+		log.Printf("Failed to fetch the head for %s, the next gap check starts at block %d: %v", c.name, c.block, err)
+		return
+	}
+	c.block = max(c.block, head)
+}
+
+func (c *subscriptionCursor) delivered(vLog types.Log) {
+	c.block = max(c.block, vLog.BlockNumber)
+}
+
+// resumeFrom is where the gap check after a reconnect starts, 0 before any
+// block was covered.
+func (c *subscriptionCursor) resumeFrom() uint64 {
+	if c.block <= reconnectMargin {
+		return c.block
+	}
+	return c.block - reconnectMargin
+}
+
+// listenQuorum subscribes to query on the n most preferred WebSocket
+// providers at once and merges their logs.
+func listenQuorum(name string, query ethereum.FilterQuery, gateway *rpcGateway, n int, handle func(types.Log, time.Time)) {
+	providers := gateway.candidates(true)
+	if len(providers) > n {
+		providers = providers[:n]
+	}
+	if len(providers) < 2 {
+		log.Printf("Log quorum for %s needs 2 WebSocket providers, only %d available", name, len(providers))
+	}
+
+	members := make([]string, len(providers))
+	for i, p := range providers {
+		members[i] = p.name
+	}
+	log.Printf("Listening for %s logs on a quorum of %s", name, strings.Join(members, ", "))
+
+	merger := newLogMerger(name, members, *quorumWindow, handle)
+
+	var wg sync.WaitGroup
+	for _, p := range providers {
+		wg.Add(1)
+		go func(p *provider) {
+			defer wg.Done()
+
+			cursor := &subscriptionCursor{name: name}
+			for {
+				logs := make(chan types.Log)
+				sub, err := gateway.SubscribeFilterLogsOn(context.Background(), priorityLive, p, query, logs)
+				if err != nil {
+					log.Printf("Failed to subscribe to %s logs on %s: %v. Retrying in 5s...", name, p.name, err)
+					time.Sleep(5 * time.Second)
+					continue
+				}
+
+				if from := cursor.resumeFrom(); from > 0 {
+					go merger.fillGap(gateway, providers, query, from)
+				}
+				cursor.subscribed(gateway)
+
+				func() {
+					defer sub.Unsubscribe()
+					for {
+						select {
+						case err := <-sub.Err():
+							log.Printf("Subscription for %s dropped on %s: %v. Reconnecting...", name, p.name, err)
+							return
+
+						case vLog := <-logs:
+							cursor.delivered(vLog)
+							merger.add(p.name, vLog)
+						}
+					}
+				}()
+
+				// avoid spamming node on reconnect
+				time.Sleep(2 * time.Second)
+			}
+		}(p)
+	}
+	wg.Wait()
+}
+
+func bigUint(v uint64) *big.Int {
+	return new(big.Int).SetUint64(v)
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fakeNode answers the JSON-RPC methods the gap checks and health checks use
+// from a fixed chain, head and set of logs.
+type fakeNode struct {
+	mu       sync.Mutex
+	chainID  uint64 // 1 when not set
+	head     uint64
+	logs     []types.Log
+	headErr  bool
+	requests map[string]int
+}
+
+func (n *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.requests == nil {
+		n.requests = make(map[string]int)
+	}
+	n.requests[req.Method]++
+
+	var result any
+	var rpcErr error
+	switch req.Method {
+	case "eth_chainId":
+		result = hexutil.Uint64(max(n.chainID, 1))
+	case "eth_blockNumber":
+		if n.headErr {
+			rpcErr = errors.New("head unavailable")
+		}
+		result = hexutil.Uint64(n.head)
+	case "eth_getLogs":
+		var q struct {
+			FromBlock hexutil.Uint64 `json:"fromBlock"`
+			ToBlock   hexutil.Uint64 `json:"toBlock"`
+		}
+		json.Unmarshal(req.Params[0], &q)
+		logs := []types.Log{}
+		for _, l := range n.logs {
+			if l.BlockNumber >= uint64(q.FromBlock) && l.BlockNumber <= uint64(q.ToBlock) {
+				logs = append(logs, l)
+			}
+		}
+		result = logs
+	default:
+		rpcErr = errors.New("method not found")
+	}
+
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	if rpcErr != nil {
+		resp["error"] = map[string]any{"code": -32000, "message": rpcErr.Error()}
+	} else {
+		resp["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// newFakeGateway serves every node over HTTP and puts a gateway in front of
+// them, in the order given.
+func newFakeGateway(t *testing.T, nodes ...*fakeNode) (*rpcGateway, []*provider) {
+	t.Helper()
+
+	var providers []*provider
+	for i, n := range nodes {
+		server := httptest.NewServer(n)
+		t.Cleanup(server.Close)
+
+		p := newProvider(i, server.URL, 0, nil)
+		p.name = string(rune('a' + i))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := p.dial(ctx)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		providers = append(providers, p)
+	}
+	return newRPCGateway(providers, big.NewInt(1)), providers
+}
+
+// testLog is a factory log in block, told apart by tx and index.
+func testLog(block uint64, tx byte, index uint) types.Log {
+	return types.Log{
+		Address:     common.HexToAddress("0x5c69bee701ef814a2b6a3edd4b1652cb9cc5aa6f"),
+		Topics:      []common.Hash{{0x0d}},
+		Data:        []byte{},
+		BlockNumber: block,
+		BlockHash:   common.BigToHash(new(big.Int).SetUint64(block)),
+		TxHash:      common.Hash{tx},
+		Index:       index,
+	}
+}
+
+// collector records the logs a merger hands on.
+type collector struct {
+	mu   sync.Mutex
+	logs []types.Log
+}
+
+func (c *collector) handle(vLog types.Log, _ time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logs = append(c.logs, vLog)
+}
+
+func (c *collector) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.logs)
+}
+
+func TestLogMergerDedupes(t *testing.T) {
+	var got collector
+	m := newLogMerger("test", nil, 0, got.handle)
+
+	first := testLog(100, 1, 0)
+	if !m.add("a", first) {
+		t.Fatal("first delivery was not handed on")
+	}
+	if m.add("b", first) {
+		t.Error("the same log from another provider was handed on again")
+	}
+	if m.add("a", first) {
+		t.Error("the same log from the same provider was handed on again")
+	}
+
+	// any of block hash, transaction and log index tells logs apart
+	otherIndex := testLog(100, 1, 1)
+	otherTx := testLog(100, 2, 0)
+	otherBlock := first
+	otherBlock.BlockHash = common.Hash{0xbb}
+	for _, l := range []types.Log{otherIndex, otherTx, otherBlock} {
+		if !m.add("b", l) {
+			t.Errorf("log %d of tx %s in block %s was taken for a repeat", l.Index, l.TxHash.Hex(), l.BlockHash.Hex())
+		}
+	}
+
+	removed := testLog(101, 3, 0)
+	removed.Removed = true
+	if m.add("a", removed) {
+		t.Error("a removed log was handed on")
+	}
+
+	if got.count() != 4 {
+		t.Errorf("handed on %d logs, expected 4", got.count())
+	}
+}
+
+func TestLogMergerAddAllInChainOrder(t *testing.T) {
+	var got collector
+	m := newLogMerger("test", nil, 0, got.handle)
+
+	found := m.addAll("a", []types.Log{testLog(102, 1, 0), testLog(100, 2, 3), testLog(100, 3, 1)})
+	if found != 3 {
+		t.Fatalf("found %d logs, expected 3", found)
+	}
+	if m.addAll("b", []types.Log{testLog(100, 2, 3), testLog(103, 4, 0)}) != 1 {
+		t.Error("logs already handed on were counted again")
+	}
+
+	var order []uint
+	for _, l := range got.logs {
+		order = append(order, uint(l.BlockNumber)*10+l.Index)
+	}
+	want := []uint{1001, 1003, 1020, 1030}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] {
+			t.Fatalf("handed on in order %v, expected %v", order, want)
+		}
+	}
+}
+
+func metricValue(m *expvar.Map, key string) int64 {
+	if v, ok := m.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestLogMergerQuorum(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		delivered []string
+		missed    []string
+		single    string
+	}{
+		{"every member", []string{"q1", "q2", "q3"}, nil, ""},
+		{"one missed", []string{"q1", "q3"}, []string{"q2"}, ""},
+		{"single provider", []string{"q2"}, []string{"q1", "q3"}, "q2"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// the window is checked by hand
+			m := newLogMerger("test", []string{"q1", "q2", "q3"}, time.Hour, func(types.Log, time.Time) {})
+
+			missedBefore := map[string]int64{}
+			singleBefore := map[string]int64{}
+			for _, member := range m.members {
+				missedBefore[member] = metricValue(metricLogsMissed, member)
+				singleBefore[member] = metricValue(metricLogsSingleProvider, member)
+			}
+
+			vLog := testLog(100, 1, 0)
+			for _, p := range tt.delivered {
+				m.add(p, vLog)
+			}
+			m.check(logKey{BlockHash: vLog.BlockHash, TxHash: vLog.TxHash, Index: vLog.Index})
+
+			for _, member := range m.members {
+				wantMissed := int64(0)
+				for _, missed := range tt.missed {
+					if missed == member {
+						wantMissed = 1
+					}
+				}
+				if got := metricValue(metricLogsMissed, member) - missedBefore[member]; got != wantMissed {
+					t.Errorf("%s missed %d logs, expected %d", member, got, wantMissed)
+				}
+
+				wantSingle := int64(0)
+				if member == tt.single {
+					wantSingle = 1
+				}
+				if got := metricValue(metricLogsSingleProvider, member) - singleBefore[member]; got != wantSingle {
+					t.Errorf("%s delivered %d logs alone, expected %d", member, got, wantSingle)
+				}
+			}
+		})
+	}
+}
+
+func TestFillGap(t *testing.T) {
+	a := &fakeNode{head: 120, logs: []types.Log{testLog(90, 1, 0), testLog(105, 2, 0), testLog(118, 3, 0)}}
+	b := &fakeNode{head: 120, logs: []types.Log{testLog(105, 2, 0), testLog(119, 4, 0)}}
+	gateway, providers := newFakeGateway(t, a, b)
+
+	var got collector
+	m := newLogMerger("test", nil, 0, got.handle)
+	m.add("a", testLog(118, 3, 0))
+
+	// every provider is asked, logs before from and ones seen already are not
+	// handed on again
+	m.fillGap(gateway, providers, ethereum.FilterQuery{}, 100)
+	if got.count() != 3 {
+		t.Fatalf("handed on %d logs, expected 3", got.count())
+	}
+	for _, n := range []*fakeNode{a, b} {
+		if n.requests["eth_getLogs"] == 0 {
+			t.Error("a provider was not asked for the gap")
+		}
+	}
+
+	// nothing to do before any block was covered or past the head
+	m.fillGap(gateway, providers, ethereum.FilterQuery{}, 0)
+	m.fillGap(gateway, providers, ethereum.FilterQuery{}, 121)
+	if got.count() != 3 {
+		t.Errorf("handed on %d logs, expected 3", got.count())
+	}
+}
+
+func TestSubscriptionCursorResume(t *testing.T) {
+	node := &fakeNode{head: 120}
+	gateway, _ := newFakeGateway(t, node)
+
+	c := subscriptionCursor{name: "test"}
+	if from := c.resumeFrom(); from != 0 {
+		t.Fatalf("resumes from %d before covering a block, expected 0", from)
+	}
+
+	// the first subscription covers from the head on
+	c.subscribed(gateway)
+	if from := c.resumeFrom(); from != 120-reconnectMargin {
+		t.Errorf("resumes from %d after subscribing, expected %d", from, 120-reconnectMargin)
+	}
+
+	// logs move it forward, never back
+	c.delivered(testLog(130, 1, 0))
+	c.delivered(testLog(125, 2, 0))
+	if from := c.resumeFrom(); from != 130-reconnectMargin {
+		t.Errorf("resumes from %d after a log in block 130, expected %d", from, 130-reconnectMargin)
+	}
+
+	// a reconnect that cannot get the head keeps the cursor
+	node.mu.Lock()
+	node.headErr = true
+	node.mu.Unlock()
+	c.subscribed(gateway)
+	if from := c.resumeFrom(); from != 130-reconnectMargin {
+		t.Errorf("resumes from %d after a failed head, expected %d", from, 130-reconnectMargin)
+	}
+
+	// near genesis there is no margin to take
+	low := subscriptionCursor{block: 3}
+	if from := low.resumeFrom(); from != 3 {
+		t.Errorf("resumes from %d at block 3, expected 3", from)
+	}
+}
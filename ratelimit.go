@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenBucket allows rate tokens per second with bursts of up to burst. It is
+// not safe for concurrent use; the gateway dispatcher owns its buckets.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// wait returns how long until n tokens are available, 0 if they are now.
+// A bucket with no rate never limits.
+func (b *tokenBucket) wait(now time.Time, n float64) time.Duration {
+	if b == nil || b.rate <= 0 {
+		return 0
+	}
+
+	b.refill(now)
+	// a request costing more than the burst can still go once the bucket is full
+	n = min(n, b.burst)
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take(n float64) {
+	if b == nil || b.rate <= 0 {
+		return
+	}
+	b.tokens -= n
+}
+
+// parseRateLimits reads "method=rate,method=rate" as used by --rpc_method_limits.
+func parseRateLimits(s string) (map[string]float64, error) {
+	limits := make(map[string]float64)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		method, rate, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected method=rate, got %q", part)
+		}
+
+		method = strings.TrimSpace(method)
+		r, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad rate for %s: %w", method, err)
+		}
+		limits[method] = r
+	}
+	return limits, nil
+}
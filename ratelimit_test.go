@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketRefill(t *testing.T) {
+	start := time.Now()
+	b := newTokenBucket(10, 5)
+	b.last = start
+
+	// a full bucket lets the whole burst through at once
+	for i := 0; i < 5; i++ {
+		if wait := b.wait(start, 1); wait != 0 {
+			t.Fatalf("request %d of the burst waits %v", i+1, wait)
+		}
+		b.take(1)
+	}
+	if wait := b.wait(start, 1); wait != 100*time.Millisecond {
+		t.Errorf("request after the burst waits %v, expected 100ms", wait)
+	}
+
+	// 10 tokens a second refill one in 100ms
+	if wait := b.wait(start.Add(100*time.Millisecond), 1); wait != 0 {
+		t.Errorf("request 100ms later waits %v", wait)
+	}
+	b.take(1)
+
+	// refills stop at the burst
+	later := start.Add(time.Hour)
+	b.wait(later, 1)
+	if b.tokens != 5 {
+		t.Errorf("bucket holds %v tokens after an hour, expected the burst of 5", b.tokens)
+	}
+}
+
+func TestTokenBucketCostsMoreThanBurst(t *testing.T) {
+	start := time.Now()
+	b := newTokenBucket(10, 5)
+	b.last = start
+
+	// a request costing more than the burst goes once the bucket is full
+	if wait := b.wait(start, 75); wait != 0 {
+		t.Errorf("expensive request on a full bucket waits %v", wait)
+	}
+	b.take(75)
+
+	// and leaves it in debt until the cost is paid off
+	if wait := b.wait(start, 1); wait != 7100*time.Millisecond {
+		t.Errorf("next request waits %v, expected 7.1s", wait)
+	}
+}
+
+func TestTokenBucketWithoutRate(t *testing.T) {
+	var nilBucket *tokenBucket
+	for _, b := range []*tokenBucket{nilBucket, newTokenBucket(0, 0)} {
+		b.take(1000)
+		if wait := b.wait(time.Now(), 1000); wait != 0 {
+			t.Errorf("bucket without a rate waits %v", wait)
+		}
+	}
+
+	// a rate below one a second still lets one request through
+	b := newTokenBucket(0.5, 0.5)
+	if b.burst != 1 {
+		t.Errorf("burst is %v, expected at least 1", b.burst)
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want map[string]float64
+		err  bool
+	}{
+		{"", map[string]float64{}, false},
+		{"eth_getLogs=10", map[string]float64{"eth_getLogs": 10}, false},
+		{" eth_getLogs = 10 , eth_call=50,", map[string]float64{"eth_getLogs": 10, "eth_call": 50}, false},
+		{"eth_call=0.5", map[string]float64{"eth_call": 0.5}, false},
+		{"eth_call=1,eth_call=2", map[string]float64{"eth_call": 2}, false},
+		{"eth_call", nil, true},
+		{"eth_call=fast", nil, true},
+	} {
+		got, err := parseRateLimits(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("parseRateLimits(%q) error %v", tt.in, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseRateLimits(%q) = %v, expected %v", tt.in, got, tt.want)
+			continue
+		}
+		for method, rate := range tt.want {
+			if got[method] != rate {
+				t.Errorf("parseRateLimits(%q) = %v, expected %v", tt.in, got, tt.want)
+			}
+		}
+	}
+}
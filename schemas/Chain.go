@@ -0,0 +1,163 @@
+package schemas
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NativeCurrency is how Uniswap V4 pools refer to the chain's native coin,
+// e.g. ETH on Ethereum or BNB on BSC. Pools of older exchanges use the wrapped
+// token instead.
+var NativeCurrency = common.Address{}
+
+// Chain is what snipr needs to know about a chain to tell the newly listed
+// token of a pool from the coin it is priced in.
+type Chain struct {
+	ID            uint64
+	Name          string
+	Native        string // symbol of the native coin
+	WrappedNative common.Address
+
+	// Quotes are the coins new tokens are paired against besides the native
+	// coin, most commonly used first. Stored pools were oriented with them by
+	// a migration, changing them needs another one.
+	Quotes []common.Address
+}
+
+var Chains = map[uint64]*Chain{
+	1: {
+		ID:            1,
+		Name:          "Ethereum",
+		Native:        "ETH",
+		WrappedNative: common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"),
+		Quotes: []common.Address{
+			common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"), // USDC
+			common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"), // USDT
+			common.HexToAddress("0x6B175474E89094C44Da98b954EedeAC495271d0F"), // DAI
+		},
+	},
+	10: {
+		ID:            10,
+		Name:          "Optimism",
+		Native:        "ETH",
+		WrappedNative: common.HexToAddress("0x4200000000000000000000000000000000000006"),
+		Quotes: []common.Address{
+			common.HexToAddress("0x0b2C639c533813f4Aa9D7837cAf62653d097Ff85"), // USDC
+		},
+	},
+	56: {
+		ID:            56,
+		Name:          "BSC",
+		Native:        "BNB",
+		WrappedNative: common.HexToAddress("0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c"),
+		Quotes: []common.Address{
+			common.HexToAddress("0x55d398326f99059fF775485246999027B3197955"), // USDT
+			common.HexToAddress("0x8AC76a51cc950d9822D68b83fE1Ad97B32Cd580d"), // USDC
+			common.HexToAddress("0xe9e7CEA3DedcA5984780Bafc599bD69ADd087D56"), // BUSD
+		},
+	},
+	137: {
+		ID:            137,
+		Name:          "Polygon",
+		Native:        "POL",
+		WrappedNative: common.HexToAddress("0x0d500B1d8E8eF31E21C99d1Db9A6444d3ADf1270"),
+		Quotes: []common.Address{
+			common.HexToAddress("0x3c499c542cEF5E3811e1192ce70d8cC03d5c3359"), // USDC
+		},
+	},
+	8453: {
+		ID:            8453,
+		Name:          "Base",
+		Native:        "ETH",
+		WrappedNative: common.HexToAddress("0x4200000000000000000000000000000000000006"),
+		Quotes: []common.Address{
+			common.HexToAddress("0x833589fCD6eDb6E08f4c7C32D4f71b54bdA02913"), // USDC
+		},
+	},
+	42161: {
+		ID:            42161,
+		Name:          "Arbitrum",
+		Native:        "ETH",
+		WrappedNative: common.HexToAddress("0x82aF49447D8a07e3bd95BD0d56f35241523fBab1"),
+		Quotes: []common.Address{
+			common.HexToAddress("0xaf88d065e77c8cC2239327C5EDb3A432268e5831"), // USDC
+			common.HexToAddress("0xFd086bC7CD5C481DCC9C85ebE478A1C0b69FCbb9"), // USDT
+		},
+	},
+	43114: {
+		ID:            43114,
+		Name:          "Avalanche",
+		Native:        "AVAX",
+		WrappedNative: common.HexToAddress("0xB31f66AA3C1e785363F0875A1B74E27b85FD66c7"),
+		Quotes: []common.Address{
+			common.HexToAddress("0xB97EF9Ef8734C71904D8002F8b6Bc66Dd9c48a6E"), // USDC
+			common.HexToAddress("0x9702230A8Ea53601f5cD2dc00fDBc13d4dF4A8c7"), // USDT
+		},
+	},
+}
+
+// ChainByID returns the chain with id. Chains snipr has no table for only
+// know their native coin.
+func ChainByID(id uint64) *Chain {
+	if chain, ok := Chains[id]; ok {
+		return chain
+	}
+	return &Chain{ID: id, Name: fmt.Sprintf("chain %d", id), Native: "native"}
+}
+
+// quoteRank is how strongly token is a quote coin, lower is stronger: the
+// native coin, its wrapped token, then Quotes in order. -1 if it is not one.
+func (ch *Chain) quoteRank(token common.Address) int {
+	switch {
+	case token == NativeCurrency:
+		return 0
+	case token == ch.WrappedNative:
+		return 1
+	}
+	for i, quote := range ch.Quotes {
+		if token == quote {
+			return 2 + i
+		}
+	}
+	return -1
+}
+
+// OrientPair tells the token of a pool from its quote coin. Pools sort their
+// tokens by address, so the quote coin is as likely to be first as second.
+// When neither or both are quote coins, a stays the token unless b is the
+// stronger quote.
+func (ch *Chain) OrientPair(a, b common.Address) (token, quote common.Address) {
+	rankA, rankB := ch.quoteRank(a), ch.quoteRank(b)
+	if rankA >= 0 && (rankB < 0 || rankA < rankB) {
+		return b, a
+	}
+	return a, b
+}
+
+// OrientTokens picks the token and the quote coin of a pool of more than two
+// tokens: the strongest quote coin, and the first of the others that is not a
+// quote coin itself, or just the first of the others when all are.
+func (ch *Chain) OrientTokens(tokens []common.Address) (token, quote common.Address) {
+	best := 0
+	for i, t := range tokens {
+		if rank := ch.quoteRank(t); rank >= 0 && (ch.quoteRank(tokens[best]) < 0 || rank < ch.quoteRank(tokens[best])) {
+			best = i
+		}
+	}
+	quote = tokens[best]
+
+	token = quote
+	for i, t := range tokens {
+		if i == best {
+			continue
+		}
+		if ch.quoteRank(t) < 0 {
+			return t, quote
+		}
+		if token == quote {
+			token = t
+		}
+	}
+	return token, quote
+}
@@ -1,11 +1,168 @@
 package schemas
 
-import "gorm.io/gorm"
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gorm.io/gorm"
+)
+
+// Pool types, by the curve the pool prices its tokens on
+const (
+	PoolTypeV2         = "v2"         // x*y=k pair
+	PoolTypeCL         = "cl"         // concentrated liquidity in ticks, V3 and V4 style
+	PoolTypeBin        = "bin"        // liquidity book, liquidity in discrete price bins
+	PoolTypeVolatile   = "volatile"   // Solidly x*y=k pool
+	PoolTypeStable     = "stable"     // Solidly x³y+y³x=k pool for pegged tokens
+	PoolTypeWeighted   = "weighted"   // Balancer weighted pool, any number of tokens
+	PoolTypeStableSwap = "stableswap" // amplified pool for pegged tokens, Curve StableSwap and Balancer stable
+	PoolTypeCrypto     = "crypto"     // Curve cryptoswap, amplified around a moving price
+	PoolTypeLaunch     = "launch"     // token launch on a launchpad, see Launchpad
+)
 
 type Contract struct {
 	gorm.Model
-	Address            string `gorm:"uniqueIndex;not null"`
+	ChainID            uint64 `gorm:"index"` // 0 for contracts stored before chains were recorded
+	Address            string `gorm:"index;not null"` // the new token, one row per pool it is listed in
 	BackingCoinAddress string
 	Exchange           string `gorm:"index"`
 	BlockNumber        uint64 `gorm:"index"`
+	PoolAddress        string `gorm:"index"` // pair or pool contract, the pool ID on V4
+	PoolType           string `gorm:"index"` // one of the PoolType constants
+	Stable             bool   // Solidly stable pool, priced on x³y+y³x=k instead of x*y=k
+	Fee                uint32 // in hundredths of a basis point, 0 for V2 pairs
+
+	// Balancer and Curve pools can hold more than two tokens. Tokens lists
+	// all of them in the pool's order and is stored in the pool_tokens table;
+	// Address and BackingCoinAddress are the token and quote coin picked from
+	// them.
+	Tokens        []PoolToken `gorm:"-"`
+	Amplification uint64      // A of stableswap pools, the unscaled A of Curve crypto pools
+
+	// Launches only: the launchpad, who launched the token and its supply
+	// when the launch event says
+	Launchpad     string `gorm:"index"`
+	Creator       string `gorm:"index"`
+	InitialSupply string // decimal, in base units
+
+	// Uniswap V4 and PancakeSwap Infinity PoolKey, together with Fee, Hooks
+	// and, on Infinity, the pool manager in Factory. The pool ID is its hash.
+	// Currency0 is the zero address when the pool is paired with the native
+	// coin.
+	Currency0   string
+	Currency1   string
+	TickSpacing int32
+	Parameters  string // Infinity only: hook bitmap and tick spacing or bin step
+	BinStep     uint16 // liquidity book pools only, in basis points
+	ActiveID    uint32 // liquidity book pools only, the bin the price started in
+
+	// Create2Mismatch is set when PoolAddress is not where the factory's
+	// CREATE2 deployment would have put the pool of these tokens, or on V4
+	// when the pool ID is not the hash of its PoolKey
+	Create2Mismatch bool `gorm:"index"`
+
+	// Provenance of the event the contract was discovered from
+	TxHash         string    `gorm:"uniqueIndex:idx_contracts_tx_log"`
+	LogIndex       uint      `gorm:"uniqueIndex:idx_contracts_tx_log"`
+	BlockHash      string
+	BlockTimestamp time.Time
+	Factory        string `gorm:"index"`
+	TxSender       string
+	ReceivedAt     time.Time
+
+	// Uniswap V4 hook of the pool, empty on exchanges without hooks
+	Hooks        string `gorm:"index"`
+	HookFlags    uint16 // permissions, see schemas.HookFlagNames
+	HookCodeHash string // keccak256 of the hook's runtime code
+	HookRisk     string `gorm:"index"` // one of the HookRisk constants
+	HookLabel    string `gorm:"index"` // from the known hook registry, empty if unknown
+
+	// ERC-20 metadata of the token at Address, empty if it could not be read
+	TokenName        string
+	TokenSymbol      string
+	TokenDecimals    *uint8
+	TokenTotalSupply string // decimal, in base units
+}
+
+// SetLog records where in the chain the contract was discovered. Block
+// timestamp and sender are not part of the log and are filled in separately.
+func (c *Contract) SetLog(vLog types.Log, receivedAt time.Time) {
+	c.BlockNumber = vLog.BlockNumber
+	c.TxHash = vLog.TxHash.Hex()
+	c.LogIndex = vLog.Index
+	c.BlockHash = vLog.BlockHash.Hex()
+	c.Factory = vLog.Address.Hex()
+	c.ReceivedAt = receivedAt
+}
+
+// Orient makes the pool's token Address and its quote coin
+// BackingCoinAddress, whichever order the pool lists them in.
+func (c *Contract) Orient(chain *Chain) {
+	if len(c.Tokens) > 2 {
+		tokens := make([]common.Address, len(c.Tokens))
+		for i, t := range c.Tokens {
+			tokens[i] = common.HexToAddress(t.Token)
+		}
+		token, quote := chain.OrientTokens(tokens)
+		c.Address = token.Hex()
+		c.BackingCoinAddress = quote.Hex()
+		return
+	}
+
+	token, quote := chain.OrientPair(common.HexToAddress(c.Address), common.HexToAddress(c.BackingCoinAddress))
+	c.Address = token.Hex()
+	c.BackingCoinAddress = quote.Hex()
+}
+
+// PoolKeyID is the V4 or Infinity pool ID recomputed from the recorded
+// PoolKey.
+func (c *Contract) PoolKeyID() common.Hash {
+	if c.Parameters != "" {
+		return InfinityPoolID(common.HexToAddress(c.Currency0), common.HexToAddress(c.Currency1), common.HexToAddress(c.Hooks),
+			common.HexToAddress(c.Factory), c.Fee, common.HexToHash(c.Parameters))
+	}
+	return V4PoolID(common.HexToAddress(c.Currency0), common.HexToAddress(c.Currency1), c.Fee, c.TickSpacing, common.HexToAddress(c.Hooks))
+}
+
+// SetTokenMetadata stores what was read from the token. Decimals is only kept
+// when hasDecimals is set, so a failed call is not confused with 0 decimals.
+func (c *Contract) SetTokenMetadata(name, symbol string, decimals uint8, hasDecimals bool, totalSupply *big.Int) {
+	c.TokenName = name
+	c.TokenSymbol = symbol
+	if hasDecimals {
+		c.TokenDecimals = &decimals
+	}
+	if totalSupply != nil {
+		c.TokenTotalSupply = totalSupply.String()
+	}
+}
+
+// TokenLabel describes the token for log output, e.g. "Pepe (PEPE), 18 decimals".
+func (c *Contract) TokenLabel() string {
+	label := c.TokenName
+	if label == "" {
+		label = "unknown name"
+	}
+	if c.TokenSymbol != "" {
+		label += " (" + c.TokenSymbol + ")"
+	}
+	if c.TokenDecimals != nil {
+		label += fmt.Sprintf(", %d decimals", *c.TokenDecimals)
+	}
+	if c.TokenTotalSupply != "" {
+		label += ", supply " + c.TokenTotalSupply
+	}
+	return label
+}
+
+// DetectionLatency is how long after the block was produced snipr received
+// the log. Zero if the block timestamp is unknown.
+func (c *Contract) DetectionLatency() time.Duration {
+	if c.BlockTimestamp.IsZero() || c.ReceivedAt.IsZero() {
+		return 0
+	}
+	return c.ReceivedAt.Sub(c.BlockTimestamp)
 }
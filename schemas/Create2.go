@@ -0,0 +1,78 @@
+package schemas
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// SortTokens orders two tokens the way V2 and V3 factories do, lowest address
+// first.
+func SortTokens(a, b common.Address) (common.Address, common.Address) {
+	if bytes.Compare(a.Bytes(), b.Bytes()) > 0 {
+		return b, a
+	}
+	return a, b
+}
+
+// V2PairAddress is where a V2 factory deploys the pair of tokenA and tokenB:
+// the salt is keccak256(abi.encodePacked(token0, token1)).
+func V2PairAddress(factory, tokenA, tokenB common.Address, initCodeHash common.Hash) common.Address {
+	token0, token1 := SortTokens(tokenA, tokenB)
+	salt := crypto.Keccak256(token0.Bytes(), token1.Bytes())
+	return crypto.CreateAddress2(factory, common.BytesToHash(salt), initCodeHash.Bytes())
+}
+
+// V3PoolAddress is where a V3 pool deployer puts the pool of tokenA and tokenB
+// with fee: the salt is keccak256(abi.encode(token0, token1, fee)).
+func V3PoolAddress(deployer, tokenA, tokenB common.Address, fee uint32, initCodeHash common.Hash) common.Address {
+	token0, token1 := SortTokens(tokenA, tokenB)
+	salt := crypto.Keccak256(
+		common.LeftPadBytes(token0.Bytes(), 32),
+		common.LeftPadBytes(token1.Bytes(), 32),
+		common.LeftPadBytes(big.NewInt(int64(fee)).Bytes(), 32),
+	)
+	return crypto.CreateAddress2(deployer, common.BytesToHash(salt), initCodeHash.Bytes())
+}
+
+// V4PoolID identifies a V4 pool, which is not a contract of its own:
+// keccak256(abi.encode(poolKey)).
+func V4PoolID(currency0, currency1 common.Address, fee uint32, tickSpacing int32, hooks common.Address) common.Hash {
+	return crypto.Keccak256Hash(
+		common.LeftPadBytes(currency0.Bytes(), 32),
+		common.LeftPadBytes(currency1.Bytes(), 32),
+		common.LeftPadBytes(big.NewInt(int64(fee)).Bytes(), 32),
+		abiInt(int64(tickSpacing)),
+		common.LeftPadBytes(hooks.Bytes(), 32),
+	)
+}
+
+// abiInt encodes a signed integer as an ABI word, sign extended.
+func abiInt(v int64) []byte {
+	word := make([]byte, 32)
+	if v < 0 {
+		for i := range word {
+			word[i] = 0xff
+		}
+	}
+	for i := 0; i < 8; i++ {
+		word[31-i] = byte(v >> (8 * i))
+	}
+	return word
+}
+
+// InfinityPoolID identifies a PancakeSwap Infinity pool:
+// keccak256(abi.encode(poolKey)), where the key also names the pool manager
+// and packs tick spacing or bin step into parameters.
+func InfinityPoolID(currency0, currency1, hooks, poolManager common.Address, fee uint32, parameters common.Hash) common.Hash {
+	return crypto.Keccak256Hash(
+		common.LeftPadBytes(currency0.Bytes(), 32),
+		common.LeftPadBytes(currency1.Bytes(), 32),
+		common.LeftPadBytes(hooks.Bytes(), 32),
+		common.LeftPadBytes(poolManager.Bytes(), 32),
+		common.LeftPadBytes(big.NewInt(int64(fee)).Bytes(), 32),
+		parameters.Bytes(),
+	)
+}
@@ -1,6 +1,7 @@
 package schemas
 
 import (
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 )
@@ -12,4 +13,34 @@ type Exchange struct {
 	WssURL  		string
 	HttpURL 		string
 	Process			func(vLog types.Log, contractAbi abi.ABI, eventName string) (*Contract, error)
+
+	// Event in ABI that announces new pools, the only one Process decodes
+	Event				string
+
+	// Chain the factory is deployed on, and the block it was deployed in,
+	// where a backfill starts. StartBlock is 0 when it is not known.
+	ChainID			uint64
+	StartBlock	uint64
+
+	// CREATE2 parameters of the pools the factory deploys
+	InitCodeHash	string
+	PoolDeployer	string // deploys the pools when it is not the factory itself
+
+	// ComputePoolAddress is where the factory deploys the pool of two tokens,
+	// nil for exchanges whose pools are not contracts of their own
+	ComputePoolAddress	func(tokenA, tokenB common.Address, fee uint32) common.Address
+
+	// ReadPool fills in what the event leaves out, like the pool itself or
+	// its starting price, with call making eth_calls at the block of the
+	// event. nil when the event says all there is.
+	ReadPool	func(call func(to common.Address, data []byte) ([]byte, error), c *Contract) error
+
+	// Router or position manager whose calls create pools, and the wrapped
+	// native token it pairs with on addLiquidityETH
+	Router					string
+	WrappedNative		string
+
+	// DecodePending returns the pools a pending transaction would create, nil
+	// if it does not create any
+	DecodePending	func(tx *types.Transaction) []*PendingPool
 }
@@ -0,0 +1,137 @@
+package schemas
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Uniswap V4 hook permissions. The pool manager only calls the hooks whose
+// bit is set in the low 14 bits of the hook contract's address.
+const (
+	HookAfterRemoveLiquidityReturnsDelta uint16 = 1 << iota
+	HookAfterAddLiquidityReturnsDelta
+	HookAfterSwapReturnsDelta
+	HookBeforeSwapReturnsDelta
+	HookAfterDonate
+	HookBeforeDonate
+	HookAfterSwap
+	HookBeforeSwap
+	HookAfterRemoveLiquidity
+	HookBeforeRemoveLiquidity
+	HookAfterAddLiquidity
+	HookBeforeAddLiquidity
+	HookAfterInitialize
+	HookBeforeInitialize
+
+	hookFlagsMask = 1<<14 - 1
+)
+
+var hookFlagNames = []struct {
+	flag uint16
+	name string
+}{
+	{HookBeforeInitialize, "beforeInitialize"},
+	{HookAfterInitialize, "afterInitialize"},
+	{HookBeforeAddLiquidity, "beforeAddLiquidity"},
+	{HookAfterAddLiquidity, "afterAddLiquidity"},
+	{HookBeforeRemoveLiquidity, "beforeRemoveLiquidity"},
+	{HookAfterRemoveLiquidity, "afterRemoveLiquidity"},
+	{HookBeforeSwap, "beforeSwap"},
+	{HookAfterSwap, "afterSwap"},
+	{HookBeforeDonate, "beforeDonate"},
+	{HookAfterDonate, "afterDonate"},
+	{HookBeforeSwapReturnsDelta, "beforeSwapReturnDelta"},
+	{HookAfterSwapReturnsDelta, "afterSwapReturnDelta"},
+	{HookAfterAddLiquidityReturnsDelta, "afterAddLiquidityReturnDelta"},
+	{HookAfterRemoveLiquidityReturnsDelta, "afterRemoveLiquidityReturnDelta"},
+}
+
+// Hook risk classes, from what the hook is able to do to a trader
+const (
+	HookRiskNone   = "none"   // no hook contract
+	HookRiskLow    = "low"    // only runs on initialize, donate or adding liquidity
+	HookRiskMedium = "medium" // can block or take from liquidity removal
+	HookRiskHigh   = "high"   // can block or tax swaps, i.e. sells
+)
+
+// swapHooks run on every swap, so they can revert sells or take a cut of them.
+const swapHooks = HookBeforeSwap | HookAfterSwap | HookBeforeSwapReturnsDelta | HookAfterSwapReturnsDelta
+
+const removeLiquidityHooks = HookBeforeRemoveLiquidity | HookAfterRemoveLiquidity |
+	HookAfterAddLiquidityReturnsDelta | HookAfterRemoveLiquidityReturnsDelta
+
+// HookFlags returns the permissions encoded in a hook address.
+func HookFlags(hooks common.Address) uint16 {
+	return (uint16(hooks[common.AddressLength-2])<<8 | uint16(hooks[common.AddressLength-1])) & hookFlagsMask
+}
+
+// InfinityHookFlags returns the permissions in the low 16 bits of the
+// parameters of a PancakeSwap Infinity pool. Infinity numbers them from
+// beforeInitialize up, the reverse of V4, so they are flipped into the V4
+// layout the other hook functions use. Mint and burn on Bin pools count as
+// adding and removing liquidity.
+func InfinityHookFlags(parameters common.Hash) uint16 {
+	bitmap := uint16(parameters[common.HashLength-2])<<8 | uint16(parameters[common.HashLength-1])
+
+	var flags uint16
+	for i := 0; i < 14; i++ {
+		if bitmap&(1<<i) != 0 {
+			flags |= 1 << (13 - i)
+		}
+	}
+	return flags
+}
+
+// InfinityTickSpacing is the int24 in bits 16-39 of the parameters of an
+// Infinity CL pool.
+func InfinityTickSpacing(parameters common.Hash) int32 {
+	v := int32(parameters[27])<<16 | int32(parameters[28])<<8 | int32(parameters[29])
+	if v&0x800000 != 0 {
+		v -= 1 << 24
+	}
+	return v
+}
+
+// InfinityBinStep is the uint16 in bits 16-31 of the parameters of an
+// Infinity Bin pool.
+func InfinityBinStep(parameters common.Hash) uint16 {
+	return uint16(parameters[28])<<8 | uint16(parameters[29])
+}
+
+// HookFlagNames lists the permissions set in flags, in the order Hooks.sol
+// declares them.
+func HookFlagNames(flags uint16) []string {
+	var names []string
+	for _, f := range hookFlagNames {
+		if flags&f.flag != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// ClassifyHookFlags is the risk of a hook judged by its permissions alone.
+func ClassifyHookFlags(hooks common.Address, flags uint16) string {
+	switch {
+	case hooks == (common.Address{}):
+		return HookRiskNone
+	case flags&swapHooks != 0:
+		return HookRiskHigh
+	case flags&removeLiquidityHooks != 0:
+		return HookRiskMedium
+	default:
+		return HookRiskLow
+	}
+}
+
+// RaiseHookRisk returns the next risk class up, for hooks whose code makes
+// them riskier than their permissions suggest.
+func RaiseHookRisk(risk string) string {
+	switch risk {
+	case HookRiskLow:
+		return HookRiskMedium
+	case HookRiskMedium:
+		return HookRiskHigh
+	default:
+		return risk
+	}
+}
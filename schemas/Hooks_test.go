@@ -0,0 +1,70 @@
+package schemas
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TestHookFlags sets each of the 14 permissions on its own, in the V4 address
+// layout and in the Infinity parameters layout, which numbers them the other
+// way around.
+func TestHookFlags(t *testing.T) {
+	for i, f := range hookFlagNames {
+		t.Run(f.name, func(t *testing.T) {
+			var hooks common.Address
+			hooks[common.AddressLength-2] = byte(f.flag >> 8)
+			hooks[common.AddressLength-1] = byte(f.flag)
+			if got := HookFlags(hooks); got != f.flag {
+				t.Errorf("HookFlags is %014b, expected %014b", got, f.flag)
+			}
+
+			var parameters common.Hash
+			bit := uint16(1) << i
+			parameters[common.HashLength-2] = byte(bit >> 8)
+			parameters[common.HashLength-1] = byte(bit)
+			if got := InfinityHookFlags(parameters); got != f.flag {
+				t.Errorf("InfinityHookFlags of bit %d is %014b, expected %014b", i, got, f.flag)
+			}
+
+			if got := HookFlagNames(f.flag); !slices.Equal(got, []string{f.name}) {
+				t.Errorf("HookFlagNames is %v", got)
+			}
+		})
+	}
+}
+
+func TestHookFlagsIgnoreHigherBits(t *testing.T) {
+	hooks := common.HexToAddress("0xffffffffffffffffffffffffffffffffffffffff")
+	if got := HookFlags(hooks); got != hookFlagsMask {
+		t.Errorf("HookFlags is %016b, expected %016b", got, uint16(hookFlagsMask))
+	}
+
+	// bits 14 and 15 of the bitmap and the tick spacing above it
+	parameters := common.HexToHash("0x00000000000000000000000000000000000000000000000000000000ffffc000")
+	if got := InfinityHookFlags(parameters); got != 0 {
+		t.Errorf("InfinityHookFlags is %016b, expected none", got)
+	}
+}
+
+func TestInfinityTickSpacing(t *testing.T) {
+	for _, tt := range []struct {
+		parameters string
+		want       int32
+	}{
+		{"0x0000000000000000000000000000000000000000000000000000000000010000", 1},
+		{"0x00000000000000000000000000000000000000000000000000000000000a0000", 10},
+		{"0x0000000000000000000000000000000000000000000000000000000000c80000", 200},
+		{"0x00000000000000000000000000000000000000000000000000000000003c0055", 60}, // with hook flags
+		{"0x000000000000000000000000000000000000000000000000000000ffffff0000", -1},
+		{"0x000000000000000000000000000000000000000000000000000000fffff60000", -10},
+		{"0x0000000000000000000000000000000000000000000000000000008000000000", -1 << 23},
+		{"0x0000000000000000000000000000000000000000000000000000007fffff0000", 1<<23 - 1},
+		{"0xffffffffffffffffffffffffffffffffffffffffffffffffffffff0000010000", 1}, // bits above are not its
+	} {
+		if got := InfinityTickSpacing(common.HexToHash(tt.parameters)); got != tt.want {
+			t.Errorf("InfinityTickSpacing(%s) is %d, expected %d", tt.parameters, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package schemas
+
+import (
+	"time"
+)
+
+// Labels of known V4 hooks
+const (
+	HookLabelBenign     = "benign"     // e.g. dynamic fees, TWAMM, limit orders
+	HookLabelLaunchpad  = "launchpad"  // hooks launchpads attach to the pools they create
+	HookLabelSuspicious = "suspicious" // not proven harmful yet, trade with care
+	HookLabelMalicious  = "malicious"  // blocks sells, drains liquidity or similar
+)
+
+var HookLabels = []string{HookLabelBenign, HookLabelLaunchpad, HookLabelSuspicious, HookLabelMalicious}
+
+// KnownHook labels a V4 hook contract on one chain. It matches by Address,
+// or by CodeHash for hooks deployed many times from the same code; one of the
+// two is left empty.
+type KnownHook struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	ChainID   uint64    `gorm:"uniqueIndex:idx_known_hooks_key;not null" json:"chain_id"`
+	Address   string    `gorm:"uniqueIndex:idx_known_hooks_key;not null" json:"address,omitempty"`
+	CodeHash  string    `gorm:"uniqueIndex:idx_known_hooks_key;not null" json:"code_hash,omitempty"`
+	Label     string    `gorm:"not null" json:"label"`
+	Name      string    `json:"name,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ValidHookLabel reports whether label is one of HookLabels.
+func ValidHookLabel(label string) bool {
+	for _, l := range HookLabels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// HookRiskForLabel is the risk a label stands for, empty when the risk
+// should still be judged from the hook's permissions.
+func HookRiskForLabel(label string) string {
+	switch label {
+	case HookLabelBenign:
+		return HookRiskLow
+	case HookLabelSuspicious, HookLabelMalicious:
+		return HookRiskHigh
+	default:
+		return ""
+	}
+}
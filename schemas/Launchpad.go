@@ -0,0 +1,41 @@
+package schemas
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Launchpad is a contract that launches tokens, often onto a bonding curve of
+// its own, before any factory creates a pool for them. Process turns its
+// launch event into a contract of pool type launch, with the launchpad, the
+// creator and the curve as its pool. Once the token graduates, its DEX pools
+// are found by the exchanges as usual and linked to the launch by token.
+type Launchpad struct {
+	Name    string
+	Address string
+	ABI     string
+	Event   string // in ABI, announces new tokens
+	Process func(vLog types.Log, contractAbi abi.ABI, eventName string) (*Contract, error)
+
+	// ReadPool fills in what the launch event leaves out, see Exchange.ReadPool
+	ReadPool func(call func(to common.Address, data []byte) ([]byte, error), c *Contract) error
+
+	ChainID    uint64
+	StartBlock uint64
+}
+
+// Exchange lets the launchpad's events be listened for and routed like the
+// events of an exchange's factory.
+func (lp *Launchpad) Exchange() *Exchange {
+	return &Exchange{
+		Name:       lp.Name,
+		Address:    lp.Address,
+		ABI:        lp.ABI,
+		Event:      lp.Event,
+		Process:    lp.Process,
+		ReadPool:   lp.ReadPool,
+		ChainID:    lp.ChainID,
+		StartBlock: lp.StartBlock,
+	}
+}
@@ -0,0 +1,20 @@
+package schemas
+
+import (
+	"time"
+)
+
+// PendingPool is a pool creation or first liquidity seen in a pending
+// transaction, before the factory has emitted its log.
+type PendingPool struct {
+	ChainID     uint64
+	Exchange    string
+	Method      string
+	TxHash      string
+	TxSender    string
+	Token0      string
+	Token1      string
+	Fee         uint32
+	PoolAddress string // expected CREATE2 address, the pool ID on V4
+	SeenAt      time.Time
+}
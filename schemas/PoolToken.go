@@ -0,0 +1,47 @@
+package schemas
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PoolToken is one of the tokens of a pool that can hold more than two, like
+// Balancer and Curve pools. Pairs and V3 style pools are fully described by
+// Address and BackingCoinAddress of their Contract and have none.
+type PoolToken struct {
+	ID          uint   `gorm:"primaryKey"`
+	ChainID     uint64 `gorm:"uniqueIndex:idx_pool_tokens_pool;not null"`
+	PoolAddress string `gorm:"uniqueIndex:idx_pool_tokens_pool;not null"`
+	Position    int    `gorm:"uniqueIndex:idx_pool_tokens_pool;not null"` // index of the token in the pool
+	Token       string `gorm:"index;not null"`
+	Weight      string // Balancer weighted pools, share of the pool with 18 decimals
+}
+
+// SetTokens records every token of the pool in the pool's order. Address and
+// BackingCoinAddress are set to the first two until the pool is oriented.
+func (c *Contract) SetTokens(tokens []common.Address) {
+	c.Tokens = make([]PoolToken, len(tokens))
+	for i, token := range tokens {
+		c.Tokens[i] = PoolToken{Position: i, Token: token.Hex()}
+	}
+	if len(tokens) > 0 {
+		c.Address = tokens[0].Hex()
+	}
+	if len(tokens) > 1 {
+		c.BackingCoinAddress = tokens[1].Hex()
+	}
+}
+
+// PoolTokens are the pool_tokens rows of the contract's pool, none while the
+// pool is not known.
+func (c *Contract) PoolTokens() []PoolToken {
+	if c.PoolAddress == "" {
+		return nil
+	}
+	rows := make([]PoolToken, len(c.Tokens))
+	for i, t := range c.Tokens {
+		t.ChainID = c.ChainID
+		t.PoolAddress = c.PoolAddress
+		rows[i] = t
+	}
+	return rows
+}
@@ -0,0 +1,141 @@
+package dex
+
+import (
+	"errors"
+	"log"
+	"math/big"
+
+	"snipr/schemas"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Balancer pool view selectors
+var (
+	selectorGetNormalizedWeights      = common.FromHex("0xf89f27ed") // getNormalizedWeights()
+	selectorGetAmplificationParameter = common.FromHex("0x6daccffa") // getAmplificationParameter()
+)
+
+// readBalancerPool tells weighted from stable Balancer pools by the views
+// they answer, and records the weights or the amplification. Pools with
+// neither, like linear pools, revert both and are left without a pool type.
+func readBalancerPool(call func(to common.Address, data []byte) ([]byte, error), c *schemas.Contract) error {
+	pool := common.HexToAddress(c.PoolAddress)
+
+	out, err := call(pool, selectorGetNormalizedWeights)
+	if err == nil {
+		if weights, ok := decodeUint256Array(out); ok && len(weights) == len(c.Tokens) {
+			c.PoolType = schemas.PoolTypeWeighted
+			for i, w := range weights {
+				c.Tokens[i].Weight = w.String()
+			}
+			return nil
+		}
+	} else if !reverted(err) {
+		return err
+	}
+
+	// (value, isUpdating, precision), value is A times precision
+	out, err = call(pool, selectorGetAmplificationParameter)
+	if err != nil {
+		if reverted(err) {
+			return nil
+		}
+		return err
+	}
+	if len(out) < 96 {
+		return errors.New("getAmplificationParameter returned too little")
+	}
+	value := new(big.Int).SetBytes(out[:32])
+	precision := new(big.Int).SetBytes(out[64:96])
+	if precision.Sign() > 0 {
+		c.PoolType = schemas.PoolTypeStableSwap
+		c.Amplification = new(big.Int).Div(value, precision).Uint64()
+	}
+	return nil
+}
+
+// reverted reports whether err is the pool reverting the call, which is an
+// answer, rather than the call not getting one.
+func reverted(err error) bool {
+	var dataErr rpc.DataError
+	return errors.As(err, &dataErr)
+}
+
+// decodeUint256Array decodes a uint256[] return value.
+func decodeUint256Array(out []byte) ([]*big.Int, bool) {
+	if len(out) < 64 {
+		return nil, false
+	}
+
+	offset := new(big.Int).SetBytes(out[:32])
+	if !offset.IsUint64() || offset.Uint64() > uint64(len(out)-32) {
+		return nil, false
+	}
+	start := offset.Uint64()
+
+	length := new(big.Int).SetBytes(out[start : start+32])
+	if !length.IsUint64() || length.Uint64() > uint64(len(out)-int(start)-32)/32 {
+		return nil, false
+	}
+
+	values := make([]*big.Int, length.Uint64())
+	for i := range values {
+		word := start + 32 + uint64(i)*32
+		values[i] = new(big.Int).SetBytes(out[word : word+32])
+	}
+	return values, true
+}
+
+// Listen for 'TokensRegistered' on the Balancer V2 Vault, which holds the
+// tokens of every Balancer pool. A pool registers with PoolRegistered and then
+// its tokens in the same transaction. The pool ID starts with the pool's
+// address, so TokensRegistered alone is enough to know both.
+//
+// Weights and amplification are not part of either event, they are read from
+// the pool, which also gives the pool type.
+func BalancerV2(d Deployment) *schemas.Exchange {
+	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
+		pool_id := vLog.Topics[1]
+
+		var tokensRegistered struct {
+			Tokens        []common.Address
+			AssetManagers []common.Address
+		}
+		err := contractAbi.UnpackIntoInterface(&tokensRegistered, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("Balancer V2: Failed to unpack TokensRegistered event data: %v", err)
+			return nil, err
+		}
+
+		log.Printf("Pool registered on Balancer V2 -\nPool ID: %s\nTokens: %v\n",
+			pool_id.Hex(),
+			tokensRegistered.Tokens,
+		)
+
+		c := &schemas.Contract{
+			Exchange:    "BalancerV2",
+			PoolAddress: common.BytesToAddress(pool_id[:20]).Hex(),
+			BlockNumber: vLog.BlockNumber,
+		}
+		c.SetTokens(tokensRegistered.Tokens)
+		return c, nil
+	}
+
+	return &schemas.Exchange{
+		Name:    "BalancerV2",
+		Address: d.Factory, // Vault
+
+		// Lightweight ABI containing ONLY the 'TokensRegistered' event
+		ABI:      `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"bytes32","name":"poolId","type":"bytes32"},{"indexed":false,"internalType":"contract IERC20[]","name":"tokens","type":"address[]"},{"indexed":false,"internalType":"address[]","name":"assetManagers","type":"address[]"}],"name":"TokensRegistered","type":"event"}]`,
+		Event:    "TokensRegistered",
+		Process:  process,
+		ReadPool: readBalancerPool,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+	}
+}
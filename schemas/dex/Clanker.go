@@ -0,0 +1,88 @@
+package dex
+
+import (
+	"log"
+	"math/big"
+
+	"snipr/schemas"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// clankerSupply is the fixed supply every Clanker v4 token is minted with,
+// 100 billion tokens of 18 decimals.
+var clankerSupply, _ = new(big.Int).SetString("100000000000000000000000000000", 10)
+
+// Listen for 'TokenCreated' on the Clanker v4 factory. Clanker has no curve,
+// it mints the token's fixed supply and puts it into a Uniswap V4 pool with
+// its own hook in the same transaction, less the extensionsSupply its
+// extensions (vaults, airdrops) take. Price discovery happens on that pool
+// from startingTick, so the launch's pool is the pool's ID.
+func Clanker(d Deployment) *schemas.Launchpad {
+	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
+		token := common.HexToAddress(vLog.Topics[1].Hex())
+		token_admin := common.HexToAddress(vLog.Topics[2].Hex())
+
+		var tokenCreated struct {
+			MsgSender        common.Address
+			TokenImage       string
+			TokenName        string
+			TokenSymbol      string
+			TokenMetadata    string
+			TokenContext     string
+			StartingTick     *big.Int
+			PoolHook         common.Address
+			PoolId           [32]byte
+			PairedToken      common.Address
+			Locker           common.Address
+			MevModule        common.Address
+			ExtensionsSupply *big.Int
+			Extensions       []common.Address
+		}
+		err := contractAbi.UnpackIntoInterface(&tokenCreated, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("Clanker: Failed to unpack TokenCreated event data: %v", err)
+			return nil, err
+		}
+
+		log.Printf("Token launched on Clanker -\nToken: %s %s (%s)\nAdmin: %s\nPaired with: %s\n",
+			token.Hex(),
+			tokenCreated.TokenName,
+			tokenCreated.TokenSymbol,
+			token_admin.Hex(),
+			tokenCreated.PairedToken.Hex(),
+		)
+
+		return &schemas.Contract{
+			Address:            token.Hex(),
+			BackingCoinAddress: tokenCreated.PairedToken.Hex(),
+			Exchange:           "Clanker",
+			PoolAddress:        common.Hash(tokenCreated.PoolId).Hex(),
+			PoolType:           schemas.PoolTypeLaunch,
+			Hooks:              tokenCreated.PoolHook.Hex(),
+			HookFlags:          schemas.HookFlags(tokenCreated.PoolHook),
+			HookRisk:           schemas.ClassifyHookFlags(tokenCreated.PoolHook, schemas.HookFlags(tokenCreated.PoolHook)),
+			Launchpad:          "Clanker",
+			Creator:            token_admin.Hex(),
+			InitialSupply:      clankerSupply.String(),
+			TokenName:          tokenCreated.TokenName,
+			TokenSymbol:        tokenCreated.TokenSymbol,
+			BlockNumber:        vLog.BlockNumber,
+		}, nil
+	}
+
+	return &schemas.Launchpad{
+		Name:    "Clanker",
+		Address: d.Factory, // Clanker
+
+		// Lightweight ABI containing ONLY the 'TokenCreated' event
+		ABI:     `[{"anonymous":false,"inputs":[{"indexed":false,"internalType":"address","name":"msgSender","type":"address"},{"indexed":true,"internalType":"address","name":"tokenAddress","type":"address"},{"indexed":true,"internalType":"address","name":"tokenAdmin","type":"address"},{"indexed":false,"internalType":"string","name":"tokenImage","type":"string"},{"indexed":false,"internalType":"string","name":"tokenName","type":"string"},{"indexed":false,"internalType":"string","name":"tokenSymbol","type":"string"},{"indexed":false,"internalType":"string","name":"tokenMetadata","type":"string"},{"indexed":false,"internalType":"string","name":"tokenContext","type":"string"},{"indexed":false,"internalType":"int24","name":"startingTick","type":"int24"},{"indexed":false,"internalType":"address","name":"poolHook","type":"address"},{"indexed":false,"internalType":"PoolId","name":"poolId","type":"bytes32"},{"indexed":false,"internalType":"address","name":"pairedToken","type":"address"},{"indexed":false,"internalType":"address","name":"locker","type":"address"},{"indexed":false,"internalType":"address","name":"mevModule","type":"address"},{"indexed":false,"internalType":"uint256","name":"extensionsSupply","type":"uint256"},{"indexed":false,"internalType":"address[]","name":"extensions","type":"address[]"}],"name":"TokenCreated","type":"event"}]`,
+		Event:   "TokenCreated",
+		Process: process,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+	}
+}
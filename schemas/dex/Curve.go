@@ -0,0 +1,359 @@
+package dex
+
+import (
+	"errors"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+
+	"snipr/schemas"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Curve fees are fractions of 1e10, ours of 1e6
+const curveFeeScale = 10_000
+
+// The StableSwap NG factory does not name the pool it deployed in its events,
+// so it is looked up in the factory's pool list with these views.
+var curveStableSwapFactoryABI = mustABI(`[{"stateMutability":"view","type":"function","name":"pool_count","inputs":[],"outputs":[{"name":"","type":"uint256"}]},{"stateMutability":"view","type":"function","name":"pool_list","inputs":[{"name":"arg0","type":"uint256"}],"outputs":[{"name":"","type":"address"}]},{"stateMutability":"view","type":"function","name":"get_coins","inputs":[{"name":"_pool","type":"address"}],"outputs":[{"name":"","type":"address[]"}]},{"stateMutability":"view","type":"function","name":"get_base_pool","inputs":[{"name":"_pool","type":"address"}],"outputs":[{"name":"","type":"address"}]}]`)
+
+// curvePoolSearch is how many of the newest pools are searched, more than are
+// ever deployed by one factory in one block.
+const curvePoolSearch = 16
+
+func mustABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// curveFactoryCall calls a view of the StableSwap NG factory and unpacks its
+// only return value.
+func curveFactoryCall(call func(to common.Address, data []byte) ([]byte, error), factory common.Address, method string, args ...any) (any, error) {
+	input, err := curveStableSwapFactoryABI.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	out, err := call(factory, input)
+	if err != nil {
+		return nil, err
+	}
+	values, err := curveStableSwapFactoryABI.Unpack(method, out)
+	if err != nil {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+// resolveCurveStableSwap finds the newest pool of the factory whose coins are
+// the ones of the contract, and whose base pool is basePool for meta pools.
+// The coins of a meta pool are its token and the LP token of the base pool.
+// Two pools of the same coins deployed in one block both resolve to the
+// later one. The pools are checked a window at a time, newest first.
+func resolveCurveStableSwap(call func(to common.Address, data []byte) ([]byte, error), factory common.Address, c *schemas.Contract, basePool *common.Address) error {
+	count, err := curveFactoryCall(call, factory, "pool_count")
+	if err != nil {
+		return err
+	}
+
+	n := count.(*big.Int).Int64()
+	oldest := max(n-curvePoolSearch, 0)
+	for newest := n - 1; newest >= oldest; newest -= curveSearchWindow {
+		window := make([]curveCandidate, min(curveSearchWindow, newest-oldest+1))
+		var wg sync.WaitGroup
+		for i := range window {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				window[i] = checkCurvePool(call, factory, newest-int64(i), c, basePool)
+			}()
+		}
+		wg.Wait()
+
+		// a newer pool that could not be checked may be the one
+		for _, candidate := range window {
+			if candidate.err != nil {
+				return candidate.err
+			}
+			if !candidate.match {
+				continue
+			}
+			if basePool != nil {
+				c.SetTokens(candidate.coins)
+			}
+			c.PoolAddress = candidate.pool.Hex()
+			return nil
+		}
+	}
+
+	return errors.New("no pool of the factory holds these coins")
+}
+
+// curveSearchWindow is how many pools are checked at once. The pool searched
+// for is almost always among the newest few.
+const curveSearchWindow = 4
+
+type curveCandidate struct {
+	pool  common.Address
+	coins []common.Address
+	match bool
+	err   error
+}
+
+// checkCurvePool reads the i-th pool of the factory and whether it is the one
+// deployed for c.
+func checkCurvePool(call func(to common.Address, data []byte) ([]byte, error), factory common.Address, i int64, c *schemas.Contract, basePool *common.Address) curveCandidate {
+	pool, err := curveFactoryCall(call, factory, "pool_list", big.NewInt(i))
+	if err != nil {
+		return curveCandidate{err: err}
+	}
+	coins, err := curveFactoryCall(call, factory, "get_coins", pool)
+	if err != nil {
+		return curveCandidate{err: err}
+	}
+	candidate := curveCandidate{pool: pool.(common.Address), coins: coins.([]common.Address)}
+
+	if basePool == nil {
+		candidate.match = sameCoins(candidate.coins, c.Tokens)
+		return candidate
+	}
+
+	if len(candidate.coins) != 2 || candidate.coins[0] != common.HexToAddress(c.Tokens[0].Token) {
+		return candidate
+	}
+	base, err := curveFactoryCall(call, factory, "get_base_pool", pool)
+	if err != nil {
+		return curveCandidate{err: err}
+	}
+	candidate.match = base.(common.Address) == *basePool
+	return candidate
+}
+
+func sameCoins(coins []common.Address, tokens []schemas.PoolToken) bool {
+	if len(coins) != len(tokens) {
+		return false
+	}
+	for i, coin := range coins {
+		if coin != common.HexToAddress(tokens[i].Token) {
+			return false
+		}
+	}
+	return true
+}
+
+// Listen for 'PlainPoolDeployed' on the Curve StableSwap NG factory
+func CurveStableSwapNG(d Deployment) *schemas.Exchange {
+	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
+		var poolDeployed struct {
+			Coins    []common.Address
+			A        *big.Int
+			Fee      *big.Int
+			Deployer common.Address
+		}
+		err := contractAbi.UnpackIntoInterface(&poolDeployed, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("Curve StableSwap NG: Failed to unpack PlainPoolDeployed event data: %v", err)
+			return nil, err
+		}
+
+		log.Printf("Plain pool deployed on Curve StableSwap NG -\nCoins: %v\n", poolDeployed.Coins)
+
+		c := &schemas.Contract{
+			Exchange:      "CurveStableSwapNG",
+			PoolType:      schemas.PoolTypeStableSwap,
+			Fee:           uint32(poolDeployed.Fee.Uint64() / curveFeeScale),
+			Amplification: poolDeployed.A.Uint64(),
+			BlockNumber:   vLog.BlockNumber,
+		}
+		c.SetTokens(poolDeployed.Coins)
+		return c, nil
+	}
+
+	resolve := func(call func(to common.Address, data []byte) ([]byte, error), c *schemas.Contract) error {
+		return resolveCurveStableSwap(call, common.HexToAddress(d.Factory), c, nil)
+	}
+
+	return &schemas.Exchange{
+		Name:    "CurveStableSwapNG",
+		Address: d.Factory, // CurveStableSwapFactoryNG
+
+		// Lightweight ABI containing ONLY the 'PlainPoolDeployed' event
+		ABI:      `[{"anonymous":false,"inputs":[{"indexed":false,"name":"coins","type":"address[]"},{"indexed":false,"name":"A","type":"uint256"},{"indexed":false,"name":"fee","type":"uint256"},{"indexed":false,"name":"deployer","type":"address"}],"name":"PlainPoolDeployed","type":"event"}]`,
+		Event:    "PlainPoolDeployed",
+		Process:  process,
+		ReadPool: resolve,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+	}
+}
+
+// Listen for 'MetaPoolDeployed' on the Curve StableSwap NG factory. A meta
+// pool pairs one coin with the LP token of a base pool.
+func CurveStableSwapNGMeta(d Deployment) *schemas.Exchange {
+	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
+		var poolDeployed struct {
+			Coin     common.Address
+			BasePool common.Address
+			A        *big.Int
+			Fee      *big.Int
+			Deployer common.Address
+		}
+		err := contractAbi.UnpackIntoInterface(&poolDeployed, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("Curve StableSwap NG: Failed to unpack MetaPoolDeployed event data: %v", err)
+			return nil, err
+		}
+
+		log.Printf("Meta pool deployed on Curve StableSwap NG -\nCoin: %s\nBase pool: %s\n",
+			poolDeployed.Coin.Hex(),
+			poolDeployed.BasePool.Hex(),
+		)
+
+		// the LP token of the base pool replaces it once the pool is found
+		c := &schemas.Contract{
+			Exchange:      "CurveStableSwapNGMeta",
+			PoolType:      schemas.PoolTypeStableSwap,
+			Fee:           uint32(poolDeployed.Fee.Uint64() / curveFeeScale),
+			Amplification: poolDeployed.A.Uint64(),
+			BlockNumber:   vLog.BlockNumber,
+		}
+		c.SetTokens([]common.Address{poolDeployed.Coin, poolDeployed.BasePool})
+		return c, nil
+	}
+
+	resolve := func(call func(to common.Address, data []byte) ([]byte, error), c *schemas.Contract) error {
+		basePool := common.HexToAddress(c.Tokens[1].Token)
+		return resolveCurveStableSwap(call, common.HexToAddress(d.Factory), c, &basePool)
+	}
+
+	return &schemas.Exchange{
+		Name:    "CurveStableSwapNGMeta",
+		Address: d.Factory, // CurveStableSwapFactoryNG
+
+		// Lightweight ABI containing ONLY the 'MetaPoolDeployed' event
+		ABI:      `[{"anonymous":false,"inputs":[{"indexed":false,"name":"coin","type":"address"},{"indexed":false,"name":"base_pool","type":"address"},{"indexed":false,"name":"A","type":"uint256"},{"indexed":false,"name":"fee","type":"uint256"},{"indexed":false,"name":"deployer","type":"address"}],"name":"MetaPoolDeployed","type":"event"}]`,
+		Event:    "MetaPoolDeployed",
+		Process:  process,
+		ReadPool: resolve,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+	}
+}
+
+// curveAMultiplier is what crypto pools scale A by, on top of N^N.
+const curveAMultiplier = 10000
+
+// curveCryptoPool fills in what Twocrypto and Tricrypto NG pools share. A and
+// gamma are packed as A << 128 | gamma, the fees as
+// mid_fee << 128 | out_fee << 64 | fee_gamma. A is stored as
+// A / (A_MULTIPLIER * N^N), comparable with the A of stableswap pools.
+func curveCryptoPool(exchange string, vLog types.Log, pool common.Address, coins []common.Address, packedAGamma, packedFeeParams *big.Int) *schemas.Contract {
+	n := int64(len(coins))
+	scale := new(big.Int).Exp(big.NewInt(n), big.NewInt(n), nil)
+	scale.Mul(scale, big.NewInt(curveAMultiplier))
+	a := new(big.Int).Rsh(packedAGamma, 128)
+	a.Div(a, scale)
+	midFee := new(big.Int).Rsh(packedFeeParams, 128)
+
+	log.Printf("Pool deployed on %s -\nPool: %s\nCoins: %v\n", exchange, pool.Hex(), coins)
+
+	c := &schemas.Contract{
+		Exchange:      exchange,
+		PoolAddress:   pool.Hex(),
+		PoolType:      schemas.PoolTypeCrypto,
+		Fee:           uint32(midFee.Uint64() / curveFeeScale),
+		Amplification: a.Uint64(),
+		BlockNumber:   vLog.BlockNumber,
+	}
+	c.SetTokens(coins)
+	return c
+}
+
+// Listen for 'TwocryptoPoolDeployed' on the Curve Twocrypto NG factory
+func CurveTwocryptoNG(d Deployment) *schemas.Exchange {
+	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
+		var poolDeployed struct {
+			Pool                    common.Address
+			Name                    string
+			Symbol                  string
+			Coins                   [2]common.Address
+			Math                    common.Address
+			Salt                    [32]byte
+			Precisions              [2]*big.Int
+			PackedAGamma            *big.Int
+			PackedFeeParams         *big.Int
+			PackedRebalancingParams *big.Int
+			PackedPrices            *big.Int
+			Deployer                common.Address
+		}
+		err := contractAbi.UnpackIntoInterface(&poolDeployed, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("Curve Twocrypto NG: Failed to unpack TwocryptoPoolDeployed event data: %v", err)
+			return nil, err
+		}
+
+		return curveCryptoPool("CurveTwocryptoNG", vLog, poolDeployed.Pool, poolDeployed.Coins[:], poolDeployed.PackedAGamma, poolDeployed.PackedFeeParams), nil
+	}
+
+	return &schemas.Exchange{
+		Name:    "CurveTwocryptoNG",
+		Address: d.Factory, // TwocryptoFactory
+
+		// Lightweight ABI containing ONLY the 'TwocryptoPoolDeployed' event
+		ABI:     `[{"anonymous":false,"inputs":[{"indexed":false,"name":"pool","type":"address"},{"indexed":false,"name":"name","type":"string"},{"indexed":false,"name":"symbol","type":"string"},{"indexed":false,"name":"coins","type":"address[2]"},{"indexed":false,"name":"math","type":"address"},{"indexed":false,"name":"salt","type":"bytes32"},{"indexed":false,"name":"precisions","type":"uint256[2]"},{"indexed":false,"name":"packed_A_gamma","type":"uint256"},{"indexed":false,"name":"packed_fee_params","type":"uint256"},{"indexed":false,"name":"packed_rebalancing_params","type":"uint256"},{"indexed":false,"name":"packed_prices","type":"uint256"},{"indexed":false,"name":"deployer","type":"address"}],"name":"TwocryptoPoolDeployed","type":"event"}]`,
+		Event:   "TwocryptoPoolDeployed",
+		Process: process,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+	}
+}
+
+// Listen for 'TricryptoPoolDeployed' on the Curve Tricrypto NG factory
+func CurveTricryptoNG(d Deployment) *schemas.Exchange {
+	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
+		var poolDeployed struct {
+			Pool                    common.Address
+			Name                    string
+			Symbol                  string
+			Weth                    common.Address
+			Coins                   [3]common.Address
+			Math                    common.Address
+			Salt                    [32]byte
+			PackedPrecisions        *big.Int
+			PackedAGamma            *big.Int
+			PackedFeeParams         *big.Int
+			PackedRebalancingParams *big.Int
+			PackedPrices            *big.Int
+			Deployer                common.Address
+		}
+		err := contractAbi.UnpackIntoInterface(&poolDeployed, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("Curve Tricrypto NG: Failed to unpack TricryptoPoolDeployed event data: %v", err)
+			return nil, err
+		}
+
+		return curveCryptoPool("CurveTricryptoNG", vLog, poolDeployed.Pool, poolDeployed.Coins[:], poolDeployed.PackedAGamma, poolDeployed.PackedFeeParams), nil
+	}
+
+	return &schemas.Exchange{
+		Name:    "CurveTricryptoNG",
+		Address: d.Factory, // TricryptoFactory
+
+		// Lightweight ABI containing ONLY the 'TricryptoPoolDeployed' event
+		ABI:     `[{"anonymous":false,"inputs":[{"indexed":false,"name":"pool","type":"address"},{"indexed":false,"name":"name","type":"string"},{"indexed":false,"name":"symbol","type":"string"},{"indexed":false,"name":"weth","type":"address"},{"indexed":false,"name":"coins","type":"address[3]"},{"indexed":false,"name":"math","type":"address"},{"indexed":false,"name":"salt","type":"bytes32"},{"indexed":false,"name":"packed_precisions","type":"uint256"},{"indexed":false,"name":"packed_A_gamma","type":"uint256"},{"indexed":false,"name":"packed_fee_params","type":"uint256"},{"indexed":false,"name":"packed_rebalancing_params","type":"uint256"},{"indexed":false,"name":"packed_prices","type":"uint256"},{"indexed":false,"name":"deployer","type":"address"}],"name":"TricryptoPoolDeployed","type":"event"}]`,
+		Event:   "TricryptoPoolDeployed",
+		Process: process,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+	}
+}
@@ -0,0 +1,70 @@
+package dex
+
+import (
+	"log"
+	"math/big"
+
+	"snipr/schemas"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Listen for 'TokenCreate' on the Four.meme token manager. The bonding curves
+// of all its tokens live in the token manager itself, which is the launch's
+// pool, and are quoted in BNB. A token that sells out its curve graduates to
+// a PancakeSwap pair.
+func FourMeme(d Deployment) *schemas.Launchpad {
+	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
+		var tokenCreate struct {
+			Creator     common.Address
+			Token       common.Address
+			RequestId   *big.Int
+			Name        string
+			Symbol      string
+			TotalSupply *big.Int
+			LaunchTime  *big.Int
+			LaunchFee   *big.Int
+		}
+		err := contractAbi.UnpackIntoInterface(&tokenCreate, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("Four.meme: Failed to unpack TokenCreate event data: %v", err)
+			return nil, err
+		}
+
+		log.Printf("Token launched on Four.meme -\nToken: %s %s (%s)\nCreator: %s\n",
+			tokenCreate.Token.Hex(),
+			tokenCreate.Name,
+			tokenCreate.Symbol,
+			tokenCreate.Creator.Hex(),
+		)
+
+		return &schemas.Contract{
+			Address:            tokenCreate.Token.Hex(),
+			BackingCoinAddress: schemas.NativeCurrency.Hex(),
+			Exchange:           "FourMeme",
+			PoolAddress:        vLog.Address.Hex(),
+			PoolType:           schemas.PoolTypeLaunch,
+			Launchpad:          "FourMeme",
+			Creator:            tokenCreate.Creator.Hex(),
+			InitialSupply:      tokenCreate.TotalSupply.String(),
+			TokenName:          tokenCreate.Name,
+			TokenSymbol:        tokenCreate.Symbol,
+			BlockNumber:        vLog.BlockNumber,
+		}, nil
+	}
+
+	return &schemas.Launchpad{
+		Name:    "FourMeme",
+		Address: d.Factory, // TokenManager2
+
+		// Lightweight ABI containing ONLY the 'TokenCreate' event
+		ABI:     `[{"anonymous":false,"inputs":[{"indexed":false,"internalType":"address","name":"creator","type":"address"},{"indexed":false,"internalType":"address","name":"token","type":"address"},{"indexed":false,"internalType":"uint256","name":"requestId","type":"uint256"},{"indexed":false,"internalType":"string","name":"name","type":"string"},{"indexed":false,"internalType":"string","name":"symbol","type":"string"},{"indexed":false,"internalType":"uint256","name":"totalSupply","type":"uint256"},{"indexed":false,"internalType":"uint256","name":"launchTime","type":"uint256"},{"indexed":false,"internalType":"uint256","name":"launchFee","type":"uint256"}],"name":"TokenCreate","type":"event"}]`,
+		Event:   "TokenCreate",
+		Process: process,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+	}
+}
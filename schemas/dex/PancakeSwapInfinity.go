@@ -0,0 +1,119 @@
+package dex
+
+import (
+	"log"
+	"math/big"
+
+	"snipr/schemas"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// infinityPool fills in what CL and Bin pools share. Unlike V4 the hook
+// permissions are not in the hook address but in the low 16 bits of the
+// pool's parameters.
+func infinityPool(exchange, poolType string, vLog types.Log, hooks common.Address, fee *big.Int, parameters [32]byte) *schemas.Contract {
+	currency0 := common.HexToAddress(vLog.Topics[2].Hex())
+	currency1 := common.HexToAddress(vLog.Topics[3].Hex())
+	hookFlags := schemas.InfinityHookFlags(parameters)
+
+	log.Printf("Pool initialized on %s -\nPool ID: %s\nCurrency0: %s\nCurrency1: %s\nHooks: %s %v\n",
+		exchange,
+		vLog.Topics[1].Hex(),
+		currency0.Hex(),
+		currency1.Hex(),
+		hooks.Hex(),
+		schemas.HookFlagNames(hookFlags),
+	)
+
+	// the listener orients the pair, see UniswapV4
+	return &schemas.Contract{
+		Address:            currency0.Hex(),
+		BackingCoinAddress: currency1.Hex(),
+		Exchange:           exchange,
+		PoolAddress:        vLog.Topics[1].Hex(),
+		PoolType:           poolType,
+		Currency0:          currency0.Hex(),
+		Currency1:          currency1.Hex(),
+		Fee:                uint32(fee.Uint64()),
+		Parameters:         common.Hash(parameters).Hex(),
+		Hooks:              hooks.Hex(),
+		HookFlags:          hookFlags,
+		HookRisk:           schemas.ClassifyHookFlags(hooks, hookFlags),
+		BlockNumber:        vLog.BlockNumber,
+	}
+}
+
+// Listen for 'Initialize' on the PancakeSwap Infinity concentrated liquidity
+// pool manager
+func PancakeSwapInfinityCL(d Deployment) *schemas.Exchange {
+	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
+		var initData struct {
+			Hooks        common.Address
+			Fee          *big.Int
+			Parameters   [32]byte
+			SqrtPriceX96 *big.Int
+			Tick         *big.Int
+		}
+		err := contractAbi.UnpackIntoInterface(&initData, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("PancakeSwap Infinity CL: Failed to unpack Initialize event data: %v", err)
+			return nil, err
+		}
+
+		c := infinityPool("PancakeSwapInfinityCL", schemas.PoolTypeCL, vLog, initData.Hooks, initData.Fee, initData.Parameters)
+		c.TickSpacing = schemas.InfinityTickSpacing(initData.Parameters)
+		return c, nil
+	}
+
+	return &schemas.Exchange{
+		Name:    "PancakeSwapInfinityCL",
+		Address: d.Factory, // CLPoolManager
+
+		// Lightweight ABI containing ONLY the 'Initialize' event
+		ABI:     `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"PoolId","name":"id","type":"bytes32"},{"indexed":true,"internalType":"Currency","name":"currency0","type":"address"},{"indexed":true,"internalType":"Currency","name":"currency1","type":"address"},{"indexed":false,"internalType":"contract IHooks","name":"hooks","type":"address"},{"indexed":false,"internalType":"uint24","name":"fee","type":"uint24"},{"indexed":false,"internalType":"bytes32","name":"parameters","type":"bytes32"},{"indexed":false,"internalType":"uint160","name":"sqrtPriceX96","type":"uint160"},{"indexed":false,"internalType":"int24","name":"tick","type":"int24"}],"name":"Initialize","type":"event"}]`,
+		Event:   "Initialize",
+		Process: process,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+	}
+}
+
+// Listen for 'Initialize' on the PancakeSwap Infinity liquidity book (Bin)
+// pool manager
+func PancakeSwapInfinityBin(d Deployment) *schemas.Exchange {
+	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
+		var initData struct {
+			Hooks      common.Address
+			Fee        *big.Int
+			Parameters [32]byte
+			ActiveId   *big.Int
+		}
+		err := contractAbi.UnpackIntoInterface(&initData, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("PancakeSwap Infinity Bin: Failed to unpack Initialize event data: %v", err)
+			return nil, err
+		}
+
+		c := infinityPool("PancakeSwapInfinityBin", schemas.PoolTypeBin, vLog, initData.Hooks, initData.Fee, initData.Parameters)
+		c.BinStep = schemas.InfinityBinStep(initData.Parameters)
+		c.ActiveID = uint32(initData.ActiveId.Uint64())
+		return c, nil
+	}
+
+	return &schemas.Exchange{
+		Name:    "PancakeSwapInfinityBin",
+		Address: d.Factory, // BinPoolManager
+
+		// Lightweight ABI containing ONLY the 'Initialize' event
+		ABI:     `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"PoolId","name":"id","type":"bytes32"},{"indexed":true,"internalType":"Currency","name":"currency0","type":"address"},{"indexed":true,"internalType":"Currency","name":"currency1","type":"address"},{"indexed":false,"internalType":"contract IHooks","name":"hooks","type":"address"},{"indexed":false,"internalType":"uint24","name":"fee","type":"uint24"},{"indexed":false,"internalType":"bytes32","name":"parameters","type":"bytes32"},{"indexed":false,"internalType":"uint24","name":"activeId","type":"uint24"}],"name":"Initialize","type":"event"}]`,
+		Event:   "Initialize",
+		Process: process,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+	}
+}
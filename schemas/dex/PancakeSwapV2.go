@@ -1,9 +1,8 @@
 package dex
 
-// TODO: check this shit 
-
 import (
 	"log"
+	"math/big"
 
 	"snipr/schemas"
 
@@ -13,11 +12,24 @@ import (
 )
 
 // Listen for 'PairCreated' on PancakeSwap V2
-func PancakeSwapV2(disableDB *bool) *schemas.Exchange {
+func PancakeSwapV2(d Deployment) *schemas.Exchange {
 	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
 		created_coin := common.HexToAddress(vLog.Topics[1].Hex())
 		backing_coin := common.HexToAddress(vLog.Topics[2].Hex())
 
+		// allPairsLength is unnamed in PancakeSwap's ABI, so go-ethereum
+		// names it after its position
+		var pairCreated struct {
+			Pair common.Address
+			Arg3 *big.Int
+		}
+
+		err := contractAbi.UnpackIntoInterface(&pairCreated, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("PancakeSwap V2: Failed to unpack PairCreated event data: %v", err)
+			return nil, err
+		}
+
 		log.Printf("Token created on PancakeSwap V2 -\nCreated Coin: %s\nBacking Coin: %s\n",
 			created_coin.Hex(),
 			backing_coin.Hex(),
@@ -27,19 +39,32 @@ func PancakeSwapV2(disableDB *bool) *schemas.Exchange {
 			Address:            created_coin.Hex(),
 			BackingCoinAddress: backing_coin.Hex(),
 			Exchange:						"PancakeSwapV2",
+			PoolAddress:				pairCreated.Pair.Hex(),
+			PoolType:				schemas.PoolTypeV2,
 			BlockNumber:				vLog.BlockNumber,
 		}
 
 		return &c, nil
 	}
 
-	return &schemas.Exchange{
+	e := &schemas.Exchange{
 		Name: "PancakeSwapV2",
-		// Official PancakeSwap V2 Factory on BSC
-		Address: "0xcA143Ce32Fe78f1f7019d7d551a6402fC5350c73", 
+		Address: d.Factory,
 		
 		// Lightweight ABI containing ONLY the 'PairCreated' event
 		ABI:     `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"token0","type":"address"},{"indexed":true,"internalType":"address","name":"token1","type":"address"},{"indexed":false,"internalType":"address","name":"pair","type":"address"},{"indexed":false,"internalType":"uint256","name":"","type":"uint256"}],"name":"PairCreated","type":"event"}]`,
+		Event:   "PairCreated",
 		Process: process,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+
+		InitCodeHash:  "0x00fb7f630766e6a796048ea87d01acd3068e8ff67d078148a3fa3f4a84f69bd5",
+		Router:        d.Router, // Router v2
+		WrappedNative: schemas.ChainByID(d.ChainID).WrappedNative.Hex(),
 	}
+	e.ComputePoolAddress = v2PoolAddress(e.Address, e.InitCodeHash)
+	e.DecodePending = v2Pending(e.Name, e.Address, e.Router, e.WrappedNative, e.ComputePoolAddress)
+
+	return e
 }
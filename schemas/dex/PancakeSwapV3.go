@@ -1,9 +1,8 @@
 package dex
 
-// TODO: check this shit
-
 import (
 	"log"
+	"math/big"
 
 	"snipr/schemas"
 
@@ -13,10 +12,22 @@ import (
 )
 
 // Listen for 'PoolCreated' on PancakeSwap V3
-func PancakeSwapV3(disableDB *bool) *schemas.Exchange {
+func PancakeSwapV3(d Deployment) *schemas.Exchange {
 	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
 		created_coin := common.HexToAddress(vLog.Topics[1].Hex())
 		backing_coin := common.HexToAddress(vLog.Topics[2].Hex())
+		fee := uint32(vLog.Topics[3].Big().Uint64())
+
+		var poolCreated struct {
+			TickSpacing *big.Int
+			Pool        common.Address
+		}
+
+		err := contractAbi.UnpackIntoInterface(&poolCreated, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("PancakeSwap V3: Failed to unpack PoolCreated event data: %v", err)
+			return nil, err
+		}
 
 		log.Printf("Token created on PancakeSwap V3 -\nCreated Coin: %s\nBacking Coin: %s\n",
 			created_coin.Hex(),
@@ -27,20 +38,35 @@ func PancakeSwapV3(disableDB *bool) *schemas.Exchange {
 			Address:            created_coin.Hex(),
 			BackingCoinAddress: backing_coin.Hex(),
 			Exchange:						"PancakeSwapV3",
+			PoolAddress:				poolCreated.Pool.Hex(),
+			PoolType:				schemas.PoolTypeCL,
+			Fee:								fee,
+			TickSpacing:				int32(poolCreated.TickSpacing.Int64()),
 			BlockNumber:				vLog.BlockNumber,
 		}
 
 		return &c, nil
 	}
 
-	return &schemas.Exchange{
+	e := &schemas.Exchange{
 		Name: "PancakeSwapV3",
 
-		// Official PancakeSwap V3 Factory on BSC
-		Address: "0x0BFbCF9fa4f9C56B0F40a671Ad40E0805A091865", 
+		Address: d.Factory,
 		
 		// Lightweight ABI containing ONLY the 'PoolCreated' event
 		ABI:     `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"token0","type":"address"},{"indexed":true,"internalType":"address","name":"token1","type":"address"},{"indexed":true,"internalType":"uint24","name":"fee","type":"uint24"},{"indexed":false,"internalType":"int24","name":"tickSpacing","type":"int24"},{"indexed":false,"internalType":"address","name":"pool","type":"address"}],"name":"PoolCreated","type":"event"}]`,
+		Event:   "PoolCreated",
 		Process: process,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+
+		// Pools are deployed by a separate contract the factory calls
+		InitCodeHash: "0x6ce8eb472fa82df5469c6ab6d485f17c3ad13c8cd7af59b3d4a8026c5ce0f7e2",
+		PoolDeployer: "0x41ff9AA7e16B8B1a8a8dc4f0eFacd93D02d071c9",
 	}
+	e.ComputePoolAddress = v3PoolAddress(e.PoolDeployer, e.InitCodeHash)
+	e.DecodePending = v3Pending(e.Name, e.Address, e.ComputePoolAddress)
+
+	return e
 }
@@ -0,0 +1,162 @@
+package dex
+
+import (
+	"log"
+	"math/big"
+
+	"snipr/schemas"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Solidly forks can pair two tokens twice, in a volatile and in a stable
+// pool, and say which in the creation event. Fees are set per factory rather
+// than per pool, so the event carries none.
+
+// solidlyContract is the pool of a Solidly style factory.
+func solidlyContract(exchange string, vLog types.Log, pool common.Address, stable bool) *schemas.Contract {
+	poolType := schemas.PoolTypeVolatile
+	if stable {
+		poolType = schemas.PoolTypeStable
+	}
+
+	log.Printf("Token created on %s (%s) -\nCreated Coin: %s\nBacking Coin: %s\n",
+		exchange,
+		poolType,
+		common.HexToAddress(vLog.Topics[1].Hex()).Hex(),
+		common.HexToAddress(vLog.Topics[2].Hex()).Hex(),
+	)
+
+	return &schemas.Contract{
+		Address:            common.HexToAddress(vLog.Topics[1].Hex()).Hex(),
+		BackingCoinAddress: common.HexToAddress(vLog.Topics[2].Hex()).Hex(),
+		Exchange:           exchange,
+		PoolAddress:        pool.Hex(),
+		PoolType:           poolType,
+		Stable:             stable,
+		BlockNumber:        vLog.BlockNumber,
+	}
+}
+
+// solidlyV2 listens for PoolCreated on the Velodrome V2 pool factory and its
+// forks, which index the stable flag.
+func solidlyV2(name string, d Deployment) *schemas.Exchange {
+	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
+		var poolCreated struct {
+			Pool           common.Address
+			AllPoolsLength *big.Int
+		}
+		err := contractAbi.UnpackIntoInterface(&poolCreated, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("%s: Failed to unpack PoolCreated event data: %v", name, err)
+			return nil, err
+		}
+
+		stable := vLog.Topics[3].Big().Sign() != 0
+		return solidlyContract(name, vLog, poolCreated.Pool, stable), nil
+	}
+
+	return &schemas.Exchange{
+		Name:    name,
+		Address: d.Factory, // PoolFactory
+
+		// Lightweight ABI containing ONLY the 'PoolCreated' event
+		ABI:     `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"token0","type":"address"},{"indexed":true,"internalType":"address","name":"token1","type":"address"},{"indexed":true,"internalType":"bool","name":"stable","type":"bool"},{"indexed":false,"internalType":"address","name":"pool","type":"address"},{"indexed":false,"internalType":"uint256","name":"allPoolsLength","type":"uint256"}],"name":"PoolCreated","type":"event"}]`,
+		Event:   "PoolCreated",
+		Process: process,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+	}
+}
+
+// Listen for 'PoolCreated' on Aerodrome, Velodrome V2 deployed on Base
+func Aerodrome(d Deployment) *schemas.Exchange {
+	return solidlyV2("Aerodrome", d)
+}
+
+// Listen for 'PoolCreated' on Velodrome V2
+func Velodrome(d Deployment) *schemas.Exchange {
+	return solidlyV2("Velodrome", d)
+}
+
+// Listen for 'PairCreated' on Thena, which keeps the original Solidly event
+// with the stable flag in the data
+func Thena(d Deployment) *schemas.Exchange {
+	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
+		var pairCreated struct {
+			Stable         bool
+			Pair           common.Address
+			AllPairsLength *big.Int
+		}
+		err := contractAbi.UnpackIntoInterface(&pairCreated, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("Thena: Failed to unpack PairCreated event data: %v", err)
+			return nil, err
+		}
+
+		return solidlyContract("Thena", vLog, pairCreated.Pair, pairCreated.Stable), nil
+	}
+
+	return &schemas.Exchange{
+		Name:    "Thena",
+		Address: d.Factory, // PairFactory
+
+		// Lightweight ABI containing ONLY the 'PairCreated' event
+		ABI:     `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"token0","type":"address"},{"indexed":true,"internalType":"address","name":"token1","type":"address"},{"indexed":false,"internalType":"bool","name":"stable","type":"bool"},{"indexed":false,"internalType":"address","name":"pair","type":"address"},{"indexed":false,"internalType":"uint256","name":"allPairsLength","type":"uint256"}],"name":"PairCreated","type":"event"}]`,
+		Event:   "PairCreated",
+		Process: process,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+	}
+}
+
+// Listen for 'PoolCreated' on Aerodrome Slipstream, concentrated liquidity
+// pools keyed by tick spacing instead of fee
+func AerodromeSlipstream(d Deployment) *schemas.Exchange {
+	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
+		created_coin := common.HexToAddress(vLog.Topics[1].Hex())
+		backing_coin := common.HexToAddress(vLog.Topics[2].Hex())
+		tickSpacing := int32(vLog.Topics[3].Big().Int64())
+
+		var poolCreated struct {
+			Pool common.Address
+		}
+		err := contractAbi.UnpackIntoInterface(&poolCreated, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("Aerodrome Slipstream: Failed to unpack PoolCreated event data: %v", err)
+			return nil, err
+		}
+
+		log.Printf("Token created on Aerodrome Slipstream -\nCreated Coin: %s\nBacking Coin: %s\n",
+			created_coin.Hex(),
+			backing_coin.Hex(),
+		)
+
+		return &schemas.Contract{
+			Address:            created_coin.Hex(),
+			BackingCoinAddress: backing_coin.Hex(),
+			Exchange:           "AerodromeSlipstream",
+			PoolAddress:        poolCreated.Pool.Hex(),
+			PoolType:           schemas.PoolTypeCL,
+			TickSpacing:        tickSpacing,
+			BlockNumber:        vLog.BlockNumber,
+		}, nil
+	}
+
+	return &schemas.Exchange{
+		Name:    "AerodromeSlipstream",
+		Address: d.Factory, // CLFactory
+
+		// Lightweight ABI containing ONLY the 'PoolCreated' event
+		ABI:     `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"token0","type":"address"},{"indexed":true,"internalType":"address","name":"token1","type":"address"},{"indexed":true,"internalType":"int24","name":"tickSpacing","type":"int24"},{"indexed":false,"internalType":"address","name":"pool","type":"address"}],"name":"PoolCreated","type":"event"}]`,
+		Event:   "PoolCreated",
+		Process: process,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+	}
+}
@@ -0,0 +1,90 @@
+package dex
+
+import (
+	"errors"
+	"log"
+	"math/big"
+
+	"snipr/schemas"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var selectorGetActiveID = common.FromHex("0xdbe65edc") // getActiveId()
+
+// readActiveID reads the bin the pair's price is in. The factory takes it as
+// an argument when creating the pair but leaves it out of LBPairCreated.
+func readActiveID(call func(to common.Address, data []byte) ([]byte, error), c *schemas.Contract) error {
+	out, err := call(common.HexToAddress(c.PoolAddress), selectorGetActiveID)
+	if err != nil {
+		return err
+	}
+	if len(out) < 32 {
+		return errors.New("getActiveId returned nothing")
+	}
+	c.ActiveID = uint32(new(big.Int).SetBytes(out[:32]).Uint64())
+	return nil
+}
+
+// traderJoeLB listens for LBPairCreated on a Liquidity Book factory. Pairs of
+// the same tokens differ by bin step, the price step between two bins.
+func traderJoeLB(name string, d Deployment) *schemas.Exchange {
+	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
+		token_x := common.HexToAddress(vLog.Topics[1].Hex())
+		token_y := common.HexToAddress(vLog.Topics[2].Hex())
+		bin_step := vLog.Topics[3].Big()
+
+		var pairCreated struct {
+			LBPair common.Address
+			Pid    *big.Int
+		}
+		err := contractAbi.UnpackIntoInterface(&pairCreated, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("%s: Failed to unpack LBPairCreated event data: %v", name, err)
+			return nil, err
+		}
+
+		log.Printf("Pair created on %s -\nToken X: %s\nToken Y: %s\nBin step: %s\n",
+			name,
+			token_x.Hex(),
+			token_y.Hex(),
+			bin_step,
+		)
+
+		return &schemas.Contract{
+			Address:            token_x.Hex(),
+			BackingCoinAddress: token_y.Hex(),
+			Exchange:           name,
+			PoolAddress:        pairCreated.LBPair.Hex(),
+			PoolType:           schemas.PoolTypeBin,
+			BinStep:            uint16(bin_step.Uint64()),
+			BlockNumber:        vLog.BlockNumber,
+		}, nil
+	}
+
+	return &schemas.Exchange{
+		Name:    name,
+		Address: d.Factory, // LBFactory
+
+		// Lightweight ABI containing ONLY the 'LBPairCreated' event
+		ABI:      `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"contract IERC20","name":"tokenX","type":"address"},{"indexed":true,"internalType":"contract IERC20","name":"tokenY","type":"address"},{"indexed":true,"internalType":"uint256","name":"binStep","type":"uint256"},{"indexed":false,"internalType":"contract ILBPair","name":"LBPair","type":"address"},{"indexed":false,"internalType":"uint256","name":"pid","type":"uint256"}],"name":"LBPairCreated","type":"event"}]`,
+		Event:    "LBPairCreated",
+		Process:  process,
+		ReadPool: readActiveID,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+	}
+}
+
+// Listen for 'LBPairCreated' on the Trader Joe Liquidity Book v2.1 factory
+func TraderJoeLBV21(d Deployment) *schemas.Exchange {
+	return traderJoeLB("TraderJoeLBV21", d)
+}
+
+// Listen for 'LBPairCreated' on the Trader Joe Liquidity Book v2.2 factory
+func TraderJoeLBV22(d Deployment) *schemas.Exchange {
+	return traderJoeLB("TraderJoeLBV22", d)
+}
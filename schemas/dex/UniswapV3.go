@@ -2,7 +2,7 @@ package dex
 
 import (
 	"log"
-	_ "math/big"
+	"math/big"
 
 	"snipr/schemas"
 
@@ -12,22 +12,22 @@ import (
 )
 
 // Listen for 'PoolCreated'
-func UniswapV3(disableDB *bool) *schemas.Exchange {
+func UniswapV3(d Deployment) *schemas.Exchange {
 	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
 		created_coin := common.HexToAddress(vLog.Topics[1].Hex())
 		backing_coin := common.HexToAddress(vLog.Topics[2].Hex())
+		fee := uint32(vLog.Topics[3].Big().Uint64())
 
-		// // Used for validation
-		// var pairCreated struct {
-		// 	Pair           common.Address
-		// 	AllPairsLength *big.Int
-		// }
-		//
-		// err := contractAbi.UnpackIntoInterface(&pairCreated, eventName, vLog.Data)
-		// if err != nil {
-		// 	log.Printf("Uniswap V3: Failed to unpack PairCreated event data: %v", err)
-		// 	return nil, err
-		// }
+		var poolCreated struct {
+			TickSpacing *big.Int
+			Pool        common.Address
+		}
+
+		err := contractAbi.UnpackIntoInterface(&poolCreated, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("Uniswap V3: Failed to unpack PoolCreated event data: %v", err)
+			return nil, err
+		}
 
 		log.Printf("Token created on Uniswap V3 -\nCreated Coin: %s\nBacking Coin: %s\n",
 			created_coin.Hex(),
@@ -38,16 +38,30 @@ func UniswapV3(disableDB *bool) *schemas.Exchange {
 			Address:            created_coin.Hex(),
 			BackingCoinAddress: backing_coin.Hex(),
 			Exchange:						"UniswapV3",
+			PoolAddress:				poolCreated.Pool.Hex(),
+			PoolType:				schemas.PoolTypeCL,
+			Fee:								fee,
+			TickSpacing:				int32(poolCreated.TickSpacing.Int64()),
 			BlockNumber:				vLog.BlockNumber,
 		}
 
 		return &c, nil
 	}
 
-	return &schemas.Exchange{
+	e := &schemas.Exchange{
 		Name: "UniswapV3",
-		Address: "0x1F98431c8aD98523631AE4a59f267346ea31F984", // Uniswap V3 factory address
+		Address: d.Factory,
 		ABI:     `[{"inputs":[],"stateMutability":"nonpayable","type":"constructor"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"uint24","name":"fee","type":"uint24"},{"indexed":true,"internalType":"int24","name":"tickSpacing","type":"int24"}],"name":"FeeAmountEnabled","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"oldOwner","type":"address"},{"indexed":true,"internalType":"address","name":"newOwner","type":"address"}],"name":"OwnerChanged","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"token0","type":"address"},{"indexed":true,"internalType":"address","name":"token1","type":"address"},{"indexed":true,"internalType":"uint24","name":"fee","type":"uint24"},{"indexed":false,"internalType":"int24","name":"tickSpacing","type":"int24"},{"indexed":false,"internalType":"address","name":"pool","type":"address"}],"name":"PoolCreated","type":"event"},{"inputs":[{"internalType":"address","name":"tokenA","type":"address"},{"internalType":"address","name":"tokenB","type":"address"},{"internalType":"uint24","name":"fee","type":"uint24"}],"name":"createPool","outputs":[{"internalType":"address","name":"pool","type":"address"}],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"internalType":"uint24","name":"fee","type":"uint24"},{"internalType":"int24","name":"tickSpacing","type":"int24"}],"name":"enableFeeAmount","outputs":[],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"internalType":"uint24","name":"","type":"uint24"}],"name":"feeAmountTickSpacing","outputs":[{"internalType":"int24","name":"","type":"int24"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"","type":"address"},{"internalType":"address","name":"","type":"address"},{"internalType":"uint24","name":"","type":"uint24"}],"name":"getPool","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"owner","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"parameters","outputs":[{"internalType":"address","name":"factory","type":"address"},{"internalType":"address","name":"token0","type":"address"},{"internalType":"address","name":"token1","type":"address"},{"internalType":"uint24","name":"fee","type":"uint24"},{"internalType":"int24","name":"tickSpacing","type":"int24"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"_owner","type":"address"}],"name":"setOwner","outputs":[],"stateMutability":"nonpayable","type":"function"}]`,
+		Event:   "PoolCreated",
 		Process: process,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+
+		InitCodeHash: "0xe34f199b19b2b4f47f68442619d555527d244f78a3297ea89325f843f87b8b54",
 	}
+	e.ComputePoolAddress = v3PoolAddress(e.Address, e.InitCodeHash)
+	e.DecodePending = v3Pending(e.Name, e.Address, e.ComputePoolAddress)
+
+	return e
 }
@@ -2,7 +2,7 @@ package dex
 
 import (
 	"log"
-	_ "math/big"
+	"math/big"
 
 	"snipr/schemas"
 
@@ -12,7 +12,7 @@ import (
 )
 
 // Listen for 'Initialize' 
-func UniswapV4(disableDB *bool) *schemas.Exchange {
+func UniswapV4(d Deployment) *schemas.Exchange {
 	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
 		// V4 Paradigm Shift: Topics[1] is the Pool ID (bytes32), NOT a contract address!
 		poolId := vLog.Topics[1].Hex()
@@ -21,47 +21,67 @@ func UniswapV4(disableDB *bool) *schemas.Exchange {
 		currency0 := common.HexToAddress(vLog.Topics[2].Hex())
 		currency1 := common.HexToAddress(vLog.Topics[3].Hex())
 
-		// ========================================================================
-		// HIGHLY RECOMMENDED: Unpack the data to check for malicious Hooks!
-		// If 'Hooks' is not the zero address (0x000...000), the pool has custom 
-		// logic attached that could restrict selling or honeypot your bot.
-		// ========================================================================
-		//
-		// var initData struct {
-		// 	Fee          uint32
-		// 	TickSpacing  int32
-		// 	Hooks        common.Address
-		// 	SqrtPriceX96 *big.Int
-		// 	Tick         int32
-		// }
-		// err := contractAbi.UnpackIntoInterface(&initData, eventName, vLog.Data)
-		// if err != nil {
-		// 	log.Printf("Uniswap V4: Failed to unpack Initialize event data: %v", err)
-		// 	return nil, err
-		// }
+		// If 'Hooks' is not the zero address (0x000...000), the pool has custom
+		// logic attached that could restrict selling or honeypot your bot. The
+		// enricher fetches the hook code and refines the risk.
+		var initData struct {
+			Fee          *big.Int
+			TickSpacing  *big.Int
+			Hooks        common.Address
+			SqrtPriceX96 *big.Int
+			Tick         *big.Int
+		}
+		err := contractAbi.UnpackIntoInterface(&initData, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("Uniswap V4: Failed to unpack Initialize event data: %v", err)
+			return nil, err
+		}
+
+		hookFlags := schemas.HookFlags(initData.Hooks)
 
-		log.Printf("Pool initialized on Uniswap V4 -\nPool ID: %s\nCurrency0: %s\nCurrency1: %s\n",
+		log.Printf("Pool initialized on Uniswap V4 -\nPool ID: %s\nCurrency0: %s\nCurrency1: %s\nHooks: %s %v\n",
 			poolId,
 			currency0.Hex(),
 			currency1.Hex(),
+			initData.Hooks.Hex(),
+			schemas.HookFlagNames(hookFlags),
 		)
 
+		// currency0 is the zero address for pools paired with the native coin,
+		// which then sorts first. The listener orients the pair.
 		c := schemas.Contract{
-			Address:            currency0.Hex(), // new token
-			BackingCoinAddress: currency1.Hex(), // backing coin
+			Address:            currency0.Hex(),
+			BackingCoinAddress: currency1.Hex(),
 			Exchange:						"UniswapV4",
+			PoolAddress:				poolId,
+			PoolType:				schemas.PoolTypeCL,
+			Currency0:					currency0.Hex(),
+			Currency1:					currency1.Hex(),
+			Fee:								uint32(initData.Fee.Uint64()),
+			TickSpacing:				int32(initData.TickSpacing.Int64()),
+			Hooks:							initData.Hooks.Hex(),
+			HookFlags:					hookFlags,
+			HookRisk:						schemas.ClassifyHookFlags(initData.Hooks, hookFlags),
 			BlockNumber:				vLog.BlockNumber,
 		}
 
 		return &c, nil
 	}
 
-	return &schemas.Exchange{
+	e := &schemas.Exchange{
 		Name: "UniswapV4",
-		Address: "0x28e2ea090877bf75740558f6bfb36a5ffee9e9df", 
+		Address: d.Factory, // PoolManager
 		
 		// Lightweight ABI containing ONLY the 'Initialize' event
 		ABI:     `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"PoolId","name":"id","type":"bytes32"},{"indexed":true,"internalType":"Currency","name":"currency0","type":"address"},{"indexed":true,"internalType":"Currency","name":"currency1","type":"address"},{"indexed":false,"internalType":"uint24","name":"fee","type":"uint24"},{"indexed":false,"internalType":"int24","name":"tickSpacing","type":"int24"},{"indexed":false,"internalType":"contract IHooks","name":"hooks","type":"address"},{"indexed":false,"internalType":"uint160","name":"sqrtPriceX96","type":"uint160"},{"indexed":false,"internalType":"int24","name":"tick","type":"int24"}],"name":"Initialize","type":"event"}]`,
+		Event:   "Initialize",
 		Process: process,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+		Router:     d.Router, // PositionManager
 	}
+	e.DecodePending = v4Pending(e.Name, e.Address, e.Router)
+
+	return e
 }
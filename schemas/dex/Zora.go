@@ -0,0 +1,108 @@
+package dex
+
+import (
+	"errors"
+	"log"
+	"math/big"
+
+	"snipr/schemas"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// selectorTotalSupply is the ERC-20 totalSupply() view.
+var selectorTotalSupply = common.FromHex("0x18160ddd")
+
+// Listen for 'CoinCreatedV4' on the Zora coin factory. Zora coins are priced
+// on a Uniswap V4 pool from the start, whose PoolKey the event carries, so the
+// launch is checked against the pool ID like a V4 pool. There is no separate
+// curve contract: the coin's hook places its liquidity in several ranges of
+// that pool, which make up the curve. The event does not carry the supply,
+// which differs between coin versions, so it is read from the coin.
+func Zora(d Deployment) *schemas.Launchpad {
+	process := func(vLog types.Log, contractAbi abi.ABI, eventName string) (*schemas.Contract, error) {
+		payout_recipient := common.HexToAddress(vLog.Topics[2].Hex())
+
+		var coinCreated struct {
+			Currency common.Address
+			Uri      string
+			Name     string
+			Symbol   string
+			Coin     common.Address
+			PoolKey  struct {
+				Currency0   common.Address
+				Currency1   common.Address
+				Fee         *big.Int
+				TickSpacing *big.Int
+				Hooks       common.Address
+			}
+			PoolKeyHash [32]byte
+			Version     string
+		}
+		err := contractAbi.UnpackIntoInterface(&coinCreated, eventName, vLog.Data)
+		if err != nil {
+			log.Printf("Zora: Failed to unpack CoinCreatedV4 event data: %v", err)
+			return nil, err
+		}
+
+		log.Printf("Coin launched on Zora -\nCoin: %s %s (%s)\nCreator: %s\nPaired with: %s\n",
+			coinCreated.Coin.Hex(),
+			coinCreated.Name,
+			coinCreated.Symbol,
+			payout_recipient.Hex(),
+			coinCreated.Currency.Hex(),
+		)
+
+		key := coinCreated.PoolKey
+		return &schemas.Contract{
+			Address:            coinCreated.Coin.Hex(),
+			BackingCoinAddress: coinCreated.Currency.Hex(),
+			Exchange:           "Zora",
+			PoolAddress:        common.Hash(coinCreated.PoolKeyHash).Hex(),
+			PoolType:           schemas.PoolTypeLaunch,
+			Currency0:          key.Currency0.Hex(),
+			Currency1:          key.Currency1.Hex(),
+			Fee:                uint32(key.Fee.Uint64()),
+			TickSpacing:        int32(key.TickSpacing.Int64()),
+			Hooks:              key.Hooks.Hex(),
+			HookFlags:          schemas.HookFlags(key.Hooks),
+			HookRisk:           schemas.ClassifyHookFlags(key.Hooks, schemas.HookFlags(key.Hooks)),
+			Launchpad:          "Zora",
+			Creator:            payout_recipient.Hex(), // the caller is often Zora's own app
+			TokenName:          coinCreated.Name,
+			TokenSymbol:        coinCreated.Symbol,
+			BlockNumber:        vLog.BlockNumber,
+		}, nil
+	}
+
+	return &schemas.Launchpad{
+		Name:    "Zora",
+		Address: d.Factory, // ZoraFactory
+
+		// Lightweight ABI containing ONLY the 'CoinCreatedV4' event
+		ABI:     `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"caller","type":"address"},{"indexed":true,"internalType":"address","name":"payoutRecipient","type":"address"},{"indexed":true,"internalType":"address","name":"platformReferrer","type":"address"},{"indexed":false,"internalType":"address","name":"currency","type":"address"},{"indexed":false,"internalType":"string","name":"uri","type":"string"},{"indexed":false,"internalType":"string","name":"name","type":"string"},{"indexed":false,"internalType":"string","name":"symbol","type":"string"},{"indexed":false,"internalType":"address","name":"coin","type":"address"},{"components":[{"internalType":"Currency","name":"currency0","type":"address"},{"internalType":"Currency","name":"currency1","type":"address"},{"internalType":"uint24","name":"fee","type":"uint24"},{"internalType":"int24","name":"tickSpacing","type":"int24"},{"internalType":"contract IHooks","name":"hooks","type":"address"}],"indexed":false,"internalType":"struct PoolKey","name":"poolKey","type":"tuple"},{"indexed":false,"internalType":"bytes32","name":"poolKeyHash","type":"bytes32"},{"indexed":false,"internalType":"string","name":"version","type":"string"}],"name":"CoinCreatedV4","type":"event"}]`,
+		Event:   "CoinCreatedV4",
+		Process: process,
+
+		ReadPool: readZoraSupply,
+
+		ChainID:    d.ChainID,
+		StartBlock: d.StartBlock,
+	}
+}
+
+// readZoraSupply records the supply the coin was minted with, as of the block
+// it was created in.
+func readZoraSupply(call func(to common.Address, data []byte) ([]byte, error), c *schemas.Contract) error {
+	out, err := call(common.HexToAddress(c.Address), selectorTotalSupply)
+	if err != nil {
+		return err
+	}
+	if len(out) < 32 {
+		return errors.New("totalSupply returned too little")
+	}
+	c.InitialSupply = new(big.Int).SetBytes(out[:32]).String()
+	return nil
+}
@@ -0,0 +1,539 @@
+package dex
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"snipr/schemas"
+)
+
+// A fixture is a pool creation log as eth_getLogs returns it and the contract
+// its exchange's Process has to turn it into, after the listener oriented it.
+//
+// Every exchange and launchpad needs at least one. The logs marked rebuilt
+// belong to pools that exist on chain, with their real factory, tokens, fee,
+// tick spacing and pool, but were put together from those rather than
+// recorded. The logs marked built only use real factories and tokens; pools,
+// creators and pool IDs are placeholders (0x...f10xx, 0x...aa) and IDs are
+// computed from their keys. Neither kind carries its block or transaction,
+// and both are to be replaced by the recorded log of a real pool, pasted
+// verbatim with its blockNumber, transactionHash and logIndex and without a
+// marker in its name.
+type fixture struct {
+	name    string
+	chainID uint64
+	log     string
+	want    schemas.Contract
+}
+
+var fixtures = []fixture{
+	{
+		name:    "Uniswap V2 USDC/WETH (rebuilt)",
+		chainID: 1,
+		log:     `{"address":"0x5c69bee701ef814a2b6a3edd4b1652cb9cc5aa6f","topics":["0x0d3648bd0f6ba80134a33ba9275ac585d9d315f0ad8355cddefde31afa28d0e9","0x000000000000000000000000a0b86991c6218b36c1d19d4a2e9eb0ce3606eb48","0x000000000000000000000000c02aaa39b223fe8d0a0e5c4f27ead9083c756cc2"],"data":"0x000000000000000000000000b4e16d0168e52d35cacd2c6185b44281ec28c9dc0000000000000000000000000000000000000000000000000000000000000000","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "UniswapV2",
+			Address:            "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+			BackingCoinAddress: "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2",
+			PoolAddress:        "0xB4e16d0168e52d35CaCD2c6185b44281Ec28C9Dc",
+			PoolType:           schemas.PoolTypeV2,
+		},
+	},
+	{
+		name:    "Uniswap V3 USDC/WETH 0.05% (rebuilt)",
+		chainID: 1,
+		log:     `{"address":"0x1f98431c8ad98523631ae4a59f267346ea31f984","topics":["0x783cca1c0412dd0d695e784568c96da2e9c22ff989357a2e8b1d9b2b4e6b7118","0x000000000000000000000000a0b86991c6218b36c1d19d4a2e9eb0ce3606eb48","0x000000000000000000000000c02aaa39b223fe8d0a0e5c4f27ead9083c756cc2","0x00000000000000000000000000000000000000000000000000000000000001f4"],"data":"0x000000000000000000000000000000000000000000000000000000000000000a00000000000000000000000088e6a0c2ddd26feeb64f039a2c41296fcb3f5640","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "UniswapV3",
+			Address:            "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+			BackingCoinAddress: "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2",
+			PoolAddress:        "0x88e6A0c2dDD26FEEb64F039a2c41296FcB3f5640",
+			PoolType:           schemas.PoolTypeCL,
+			Fee:                500,
+			TickSpacing:        10,
+		},
+	},
+	{
+		name:    "Uniswap V4 ETH/USDC 0.05% (rebuilt)",
+		chainID: 1,
+		log:     `{"address":"0x000000000004444c5dc75cb358380d2e3de08a90","topics":["0xdd466e674ea557f56295e2d0218a125ea4b4f0f6f3307b95f85e6110838d6438","0x21c67e77068de97969ba93d4aab21826d33ca12bb9f565d8496e8fda8a82ca27","0x0000000000000000000000000000000000000000000000000000000000000000","0x000000000000000000000000a0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"],"data":"0x00000000000000000000000000000000000000000000000000000000000001f4000000000000000000000000000000000000000000000000000000000000000a000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "UniswapV4",
+			Address:            "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+			BackingCoinAddress: "0x0000000000000000000000000000000000000000",
+			PoolAddress:        "0x21c67e77068de97969ba93d4aab21826d33ca12bb9f565d8496e8fda8a82ca27",
+			PoolType:           schemas.PoolTypeCL,
+			Currency0:          "0x0000000000000000000000000000000000000000",
+			Currency1:          "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+			Fee:                500,
+			TickSpacing:        10,
+			Hooks:              "0x0000000000000000000000000000000000000000",
+			HookRisk:           schemas.HookRiskNone,
+		},
+	},
+	{
+		// PancakeSwap's ABI leaves allPairsLength unnamed
+		name:    "PancakeSwap V2 WBNB/BUSD (rebuilt)",
+		chainID: 56,
+		log:     `{"address":"0xca143ce32fe78f1f7019d7d551a6402fc5350c73","topics":["0x0d3648bd0f6ba80134a33ba9275ac585d9d315f0ad8355cddefde31afa28d0e9","0x000000000000000000000000bb4cdb9cbd36b01bd1cbaebf2de08d9173bc095c","0x000000000000000000000000e9e7cea3dedca5984780bafc599bd69add087d56"],"data":"0x00000000000000000000000058f876857a02d6762e0101bb5c46a8c1ed44dc160000000000000000000000000000000000000000000000000000000000000000","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "PancakeSwapV2",
+			Address:            "0xe9e7CEA3DedcA5984780Bafc599bD69ADd087D56",
+			BackingCoinAddress: "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c",
+			PoolAddress:        "0x58F876857a02D6762E0101bb5C46A8c1ED44Dc16",
+			PoolType:           schemas.PoolTypeV2,
+		},
+	},
+	{
+		// the pool address comes from the pool deployer, not the factory
+		name:    "PancakeSwap V3 USDT/WBNB 0.05% (rebuilt)",
+		chainID: 56,
+		log:     `{"address":"0x0bfbcf9fa4f9c56b0f40a671ad40e0805a091865","topics":["0x783cca1c0412dd0d695e784568c96da2e9c22ff989357a2e8b1d9b2b4e6b7118","0x00000000000000000000000055d398326f99059ff775485246999027b3197955","0x000000000000000000000000bb4cdb9cbd36b01bd1cbaebf2de08d9173bc095c","0x00000000000000000000000000000000000000000000000000000000000001f4"],"data":"0x000000000000000000000000000000000000000000000000000000000000000a00000000000000000000000036696169c63e42cd08ce11f5deebbcebae652050","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "PancakeSwapV3",
+			Address:            "0x55d398326f99059fF775485246999027B3197955",
+			BackingCoinAddress: "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c",
+			PoolAddress:        "0x36696169C63e42cd08ce11f5deeBbCeBae652050",
+			PoolType:           schemas.PoolTypeCL,
+			Fee:                500,
+			TickSpacing:        10,
+		},
+	},
+	{
+		// the Vault names neither pool nor type, the pool ID starts with the
+		// pool's address and the 80/20 weights are read from the pool
+		name:    "Balancer V2 80BAL/20WETH (rebuilt)",
+		chainID: 1,
+		log:     `{"address":"0xba12222222228d8ba445958a75a0704d566bf2c8","topics":["0xf5847d3f2197b16cdcd2098ec95d0905cd1abdaf415f07bb7cef2bba8ac5dec4","0x5c6ee304399dbdb9c8ef030ab642b10820db8f56000200000000000000000014"],"data":"0x000000000000000000000000000000000000000000000000000000000000004000000000000000000000000000000000000000000000000000000000000000a00000000000000000000000000000000000000000000000000000000000000002000000000000000000000000ba100000625a3754423978a60c9317c58a424e3d000000000000000000000000c02aaa39b223fe8d0a0e5c4f27ead9083c756cc2000000000000000000000000000000000000000000000000000000000000000200000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "BalancerV2",
+			Address:            "0xba100000625a3754423978a60c9317c58a424e3D",
+			BackingCoinAddress: "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2",
+			PoolAddress:        "0x5c6Ee304399DBdB9C8Ef030aB642B10820DB8F56",
+			Tokens: []schemas.PoolToken{
+				{Position: 0, Token: "0xba100000625a3754423978a60c9317c58a424e3D"},
+				{Position: 1, Token: "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"},
+			},
+		},
+	},
+	{
+		// tick spacing 50 in bits 16-39 of the parameters, no hook permissions
+		name:    "PancakeSwap Infinity CL BNB/CAKE (built)",
+		chainID: 56,
+		log:     `{"address":"0xa0ffb9c1ce1fe56963b0321b32e7a0302114058b","topics":["0x426cc62fe6a33a40ba2788c2c87a9c34ee4582b95bc9fa5a7bb7ae70b750b99c","0x0a3526b8c3aee5702ac24eb1671bed3b855ed37627ac9ce67dcff041a3ec516a","0x0000000000000000000000000000000000000000000000000000000000000000","0x0000000000000000000000000e09fabb73bd3ade0a17ecc321fd13a19e81ce82"],"data":"0x000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000009c400000000000000000000000000000000000000000000000000000000003200000000000000000000000000000000000000000001000000000000000000000000ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffa60c","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "PancakeSwapInfinityCL",
+			Address:            "0x0E09FaBB73Bd3Ade0a17ECC321fD13a19e81cE82",
+			BackingCoinAddress: "0x0000000000000000000000000000000000000000",
+			PoolAddress:        "0x0a3526b8c3aee5702ac24eb1671bed3b855ed37627ac9ce67dcff041a3ec516a",
+			PoolType:           schemas.PoolTypeCL,
+			Currency0:          "0x0000000000000000000000000000000000000000",
+			Currency1:          "0x0E09FaBB73Bd3Ade0a17ECC321fD13a19e81cE82",
+			Fee:                2500,
+			TickSpacing:        50,
+			Parameters:         "0x0000000000000000000000000000000000000000000000000000000000320000",
+			Hooks:              "0x0000000000000000000000000000000000000000",
+			HookRisk:           schemas.HookRiskNone,
+		},
+	},
+	{
+		// bin step 10 in bits 16-31 of the parameters
+		name:    "PancakeSwap Infinity Bin BNB/CAKE (built)",
+		chainID: 56,
+		log:     `{"address":"0xc697d2898e0d09264376196696c51d7abbbaa4a9","topics":["0xddfde5903015c0eb1671976c6c8f760f1328bec57f15286b6bdab2f955cab9c9","0x97879a38868afff8621efc3f6c9cfdd8c45a3aa98447f223774ced0046110f47","0x0000000000000000000000000000000000000000000000000000000000000000","0x0000000000000000000000000e09fabb73bd3ade0a17ecc321fd13a19e81ce82"],"data":"0x000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000009c400000000000000000000000000000000000000000000000000000000000a00000000000000000000000000000000000000000000000000000000000000800000","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "PancakeSwapInfinityBin",
+			Address:            "0x0E09FaBB73Bd3Ade0a17ECC321fD13a19e81cE82",
+			BackingCoinAddress: "0x0000000000000000000000000000000000000000",
+			PoolAddress:        "0x97879a38868afff8621efc3f6c9cfdd8c45a3aa98447f223774ced0046110f47",
+			PoolType:           schemas.PoolTypeBin,
+			Currency0:          "0x0000000000000000000000000000000000000000",
+			Currency1:          "0x0E09FaBB73Bd3Ade0a17ECC321fD13a19e81cE82",
+			Fee:                2500,
+			Parameters:         "0x00000000000000000000000000000000000000000000000000000000000a0000",
+			BinStep:            10,
+			ActiveID:           8388608,
+			Hooks:              "0x0000000000000000000000000000000000000000",
+			HookRisk:           schemas.HookRiskNone,
+		},
+	},
+	{
+		name:    "Aerodrome volatile WETH/AERO (built)",
+		chainID: 8453,
+		log:     `{"address":"0x420dd381b31aef6683db6b902084cb0ffece40da","topics":["0x2128d88d14c80cb081c1252a5acff7a264671bf199ce226b53788fb26065005e","0x0000000000000000000000004200000000000000000000000000000000000006","0x000000000000000000000000940181a94a35a4569e4529a3cdfb74e38fd98631","0x0000000000000000000000000000000000000000000000000000000000000000"],"data":"0x00000000000000000000000000000000000000000000000000000000000f10010000000000000000000000000000000000000000000000000000000000000001","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "Aerodrome",
+			Address:            "0x940181a94A35A4569E4529A3CDfB74e38FD98631",
+			BackingCoinAddress: "0x4200000000000000000000000000000000000006",
+			PoolAddress:        "0x00000000000000000000000000000000000f1001",
+			PoolType:           schemas.PoolTypeVolatile,
+		},
+	},
+	{
+		name:    "Aerodrome Slipstream WETH/USDC tick spacing 100 (built)",
+		chainID: 8453,
+		log:     `{"address":"0x5e7bb104d84c7cb9b682aac2f3d509f5f406809a","topics":["0xab0d57f0df537bb25e80245ef7748fa62353808c54d6e528a9dd20887aed9ac2","0x0000000000000000000000004200000000000000000000000000000000000006","0x000000000000000000000000833589fcd6edb6e08f4c7c32d4f71b54bda02913","0x0000000000000000000000000000000000000000000000000000000000000064"],"data":"0x00000000000000000000000000000000000000000000000000000000000f1002","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "AerodromeSlipstream",
+			Address:            "0x833589fCD6eDb6E08f4c7C32D4f71b54bdA02913",
+			BackingCoinAddress: "0x4200000000000000000000000000000000000006",
+			PoolAddress:        "0x00000000000000000000000000000000000f1002",
+			PoolType:           schemas.PoolTypeCL,
+			TickSpacing:        100,
+		},
+	},
+	{
+		name:    "Velodrome stable USDC/DAI (built)",
+		chainID: 10,
+		log:     `{"address":"0xf1046053aa5682b4f9a81b5481394da16be5ff5a","topics":["0x2128d88d14c80cb081c1252a5acff7a264671bf199ce226b53788fb26065005e","0x0000000000000000000000000b2c639c533813f4aa9d7837caf62653d097ff85","0x000000000000000000000000da10009cbd5d07dd0cecc66161fc93d7c9000da1","0x0000000000000000000000000000000000000000000000000000000000000001"],"data":"0x00000000000000000000000000000000000000000000000000000000000f10030000000000000000000000000000000000000000000000000000000000000001","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "Velodrome",
+			Address:            "0xDA10009cBd5D07dd0CeCc66161FC93D7c9000da1",
+			BackingCoinAddress: "0x0b2C639c533813f4Aa9D7837cAf62653d097Ff85",
+			PoolAddress:        "0x00000000000000000000000000000000000f1003",
+			PoolType:           schemas.PoolTypeStable,
+			Stable:             true,
+		},
+	},
+	{
+		// the original Solidly event, stable flag in the data
+		name:    "Thena volatile WBNB/THE (built)",
+		chainID: 56,
+		log:     `{"address":"0xafd89d21bdb66d00817d4153e055830b1c2b3970","topics":["0xc4805696c66d7cf352fc1d6bb633ad5ee82f6cb577c453024b6e0eb8306c6fc9","0x000000000000000000000000bb4cdb9cbd36b01bd1cbaebf2de08d9173bc095c","0x000000000000000000000000f4c8e32eadec4bfe97e0f595add0f4450a863a11"],"data":"0x000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000f10040000000000000000000000000000000000000000000000000000000000000001","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "Thena",
+			Address:            "0xF4C8E32EaDEC4BFe97E0F595AdD0f4450a863a11",
+			BackingCoinAddress: "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c",
+			PoolAddress:        "0x00000000000000000000000000000000000f1004",
+			PoolType:           schemas.PoolTypeVolatile,
+		},
+	},
+	{
+		// the event does not name the pool, it is looked up in the factory
+		name:    "Curve StableSwap NG USDC/crvUSD (built)",
+		chainID: 1,
+		log:     `{"address":"0x6a8cbed756804b16e05e741edabd5cb544ae21bf","topics":["0xd1d60d4611e4091bb2e5f699eeb79136c21ac2305ad609f3de569afc3471eecc"],"data":"0x000000000000000000000000000000000000000000000000000000000000008000000000000000000000000000000000000000000000000000000000000003e800000000000000000000000000000000000000000000000000000000000f424000000000000000000000000000000000000000000000000000000000000000aa0000000000000000000000000000000000000000000000000000000000000002000000000000000000000000a0b86991c6218b36c1d19d4a2e9eb0ce3606eb48000000000000000000000000f939e0a03fb07f59a73314e73794be0e57ac1b4e","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "CurveStableSwapNG",
+			Address:            "0xf939E0A03FB07F59A73314E73794Be0E57ac1b4E",
+			BackingCoinAddress: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+			PoolType:           schemas.PoolTypeStableSwap,
+			Fee:                100,
+			Amplification:      1000,
+			Tokens: []schemas.PoolToken{
+				{Position: 0, Token: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"},
+				{Position: 1, Token: "0xf939E0A03FB07F59A73314E73794Be0E57ac1b4E"},
+			},
+		},
+	},
+	{
+		// the base pool stands in for its LP token until the pool is found
+		name:    "Curve StableSwap NG meta FRAX/3pool (built)",
+		chainID: 1,
+		log:     `{"address":"0x6a8cbed756804b16e05e741edabd5cb544ae21bf","topics":["0x01f31cd2abdeb4e5e10ba500f2db0f937d9e8c735ab04681925441b4ea37eda5"],"data":"0x000000000000000000000000853d955acef822db058eb8505911ed77f175b99e000000000000000000000000bebc44782c7db0a1a60cb6fe97d0b483032ff1c700000000000000000000000000000000000000000000000000000000000001f400000000000000000000000000000000000000000000000000000000003d090000000000000000000000000000000000000000000000000000000000000000aa","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "CurveStableSwapNGMeta",
+			Address:            "0x853d955aCEf822Db058eb8505911ED77F175b99e",
+			BackingCoinAddress: "0xbEbc44782C7dB0a1A60Cb6fe97d0b483032FF1C7",
+			PoolType:           schemas.PoolTypeStableSwap,
+			Fee:                400,
+			Amplification:      500,
+			Tokens: []schemas.PoolToken{
+				{Position: 0, Token: "0x853d955aCEf822Db058eb8505911ED77F175b99e"},
+				{Position: 1, Token: "0xbEbc44782C7dB0a1A60Cb6fe97d0b483032FF1C7"},
+			},
+		},
+	},
+	{
+		name:    "Curve Twocrypto NG WETH/CRV (built)",
+		chainID: 1,
+		log:     `{"address":"0x98ee851a00abee0d95d08cf4ca2bdce32aeaaf7f","topics":["0x8152a3037e3dc54154ad0d2cadb1cf7e1d1b9e2b625faa3dfb4fe03d609102ca"],"data":"0x00000000000000000000000000000000000000000000000000000000000f100500000000000000000000000000000000000000000000000000000000000001c00000000000000000000000000000000000000000000000000000000000000200000000000000000000000000c02aaa39b223fe8d0a0e5c4f27ead9083c756cc2000000000000000000000000d533a949740bb3306d119cc777fa900ba034cd5200000000000000000000000000000000000000000000000000000000000000aa00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000001000000000000000000000000000000000000000000000000000000000000000100000000000000000000000000061a800000000000000000000083e0717e1000000000000000000000000000018cba800000000002aea5400000d12f0c4c60000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000aa00000000000000000000000000000000000000000000000000000000000000074352562f4554480000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000066372766574680000000000000000000000000000000000000000000000000000","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "CurveTwocryptoNG",
+			Address:            "0xD533a949740bb3306d119CC777fa900bA034cd52",
+			BackingCoinAddress: "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2",
+			PoolAddress:        "0x00000000000000000000000000000000000f1005",
+			PoolType:           schemas.PoolTypeCrypto,
+			Fee:                2600,
+			Amplification:      10, // 400000 / (10000 * 2^2)
+			Tokens: []schemas.PoolToken{
+				{Position: 0, Token: "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"},
+				{Position: 1, Token: "0xD533a949740bb3306d119CC777fa900bA034cd52"},
+			},
+		},
+	},
+	{
+		// WETH is the strongest quote, USDC a quote itself, so WBTC is the token
+		name:    "Curve Tricrypto NG USDC/WBTC/WETH (built)",
+		chainID: 1,
+		log:     `{"address":"0x0c0e5f2ff0ff18a3be9b835635039256dc4b4963","topics":["0xa307f5d0802489baddec443058a63ce115756de9020e2b07d3e2cd2f21269e2a"],"data":"0x00000000000000000000000000000000000000000000000000000000000f100600000000000000000000000000000000000000000000000000000000000001e00000000000000000000000000000000000000000000000000000000000000220000000000000000000000000c02aaa39b223fe8d0a0e5c4f27ead9083c756cc2000000000000000000000000a0b86991c6218b36c1d19d4a2e9eb0ce3606eb480000000000000000000000002260fac5e5542a773aa44fbcfedf7c193bc2c599000000000000000000000000c02aaa39b223fe8d0a0e5c4f27ead9083c756cc200000000000000000000000000000000000000000000000000000000000000aa00000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000001a0e6d000000000000000000000abd8940e805000000000000000000000000002dc6c00000000001c9c3800001c6bf526340000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000aa000000000000000000000000000000000000000000000000000000000000000d54726963727970746f5553444300000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000f6372765553444357425443574554480000000000000000000000000000000000","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "CurveTricryptoNG",
+			Address:            "0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599",
+			BackingCoinAddress: "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2",
+			PoolAddress:        "0x00000000000000000000000000000000000f1006",
+			PoolType:           schemas.PoolTypeCrypto,
+			Fee:                300,
+			Amplification:      6, // 1707629 / (10000 * 3^3)
+			Tokens: []schemas.PoolToken{
+				{Position: 0, Token: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"},
+				{Position: 1, Token: "0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599"},
+				{Position: 2, Token: "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"},
+			},
+		},
+	},
+	{
+		// the active bin is not in the event, it is read from the pair
+		name:    "Trader Joe LB v2.1 ARB/USDC bin step 15 (built)",
+		chainID: 42161,
+		log:     `{"address":"0x8e42f2f4101563bf679975178e880fd87d3efd4e","topics":["0x2c8d104b27c6b7f4492017a6f5cf3803043688934ebcaa6a03540beeaf976aff","0x000000000000000000000000912ce59144191c1204e64559fe8253a0e49e6548","0x000000000000000000000000af88d065e77c8cc2239327c5edb3a432268e5831","0x000000000000000000000000000000000000000000000000000000000000000f"],"data":"0x00000000000000000000000000000000000000000000000000000000000f10070000000000000000000000000000000000000000000000000000000000000001","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "TraderJoeLBV21",
+			Address:            "0x912CE59144191C1204E64559FE8253a0e49E6548",
+			BackingCoinAddress: "0xaf88d065e77c8cC2239327C5EDb3A432268e5831",
+			PoolAddress:        "0x00000000000000000000000000000000000f1007",
+			PoolType:           schemas.PoolTypeBin,
+			BinStep:            15,
+		},
+	},
+	{
+		name:    "Trader Joe LB v2.2 CAKE/WBNB bin step 25 (built)",
+		chainID: 56,
+		log:     `{"address":"0xb43120c4745967fa9b93e79c149e66b0f2d6fe0c","topics":["0x2c8d104b27c6b7f4492017a6f5cf3803043688934ebcaa6a03540beeaf976aff","0x0000000000000000000000000e09fabb73bd3ade0a17ecc321fd13a19e81ce82","0x000000000000000000000000bb4cdb9cbd36b01bd1cbaebf2de08d9173bc095c","0x0000000000000000000000000000000000000000000000000000000000000019"],"data":"0x00000000000000000000000000000000000000000000000000000000000f10080000000000000000000000000000000000000000000000000000000000000001","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "TraderJoeLBV22",
+			Address:            "0x0E09FaBB73Bd3Ade0a17ECC321fD13a19e81cE82",
+			BackingCoinAddress: "0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c",
+			PoolAddress:        "0x00000000000000000000000000000000000f1008",
+			PoolType:           schemas.PoolTypeBin,
+			BinStep:            25,
+		},
+	},
+	{
+		// the hook swaps, which makes it high risk
+		name:    "Clanker token paired with WETH (built)",
+		chainID: 8453,
+		log:     `{"address":"0xe85a59c628f7d27878aceb4bf3b35733630083a9","topics":["0x9299d1d1a88d8e1abdc591ae7a167a6bc63a8f17d695804e9091ee33aa89fb67","0x00000000000000000000000000000000000000000000000000000000000f100a","0x00000000000000000000000000000000000000000000000000000000000000aa"],"data":"0x00000000000000000000000000000000000000000000000000000000000000aa00000000000000000000000000000000000000000000000000000000000001c000000000000000000000000000000000000000000000000000000000000001e0000000000000000000000000000000000000000000000000000000000000022000000000000000000000000000000000000000000000000000000000000002600000000000000000000000000000000000000000000000000000000000000280fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffc7c0000000000000000000000000000000000000000000000000000000000000028cc00000000000000000000000000000000000000000000000000000000000f1009000000000000000000000000420000000000000000000000000000000000000600000000000000000000000000000000000000000000000000000000000000aa00000000000000000000000000000000000000000000000000000000000000aa000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000002a000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000007466978747572650000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000034649580000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "Clanker",
+			Address:            "0x00000000000000000000000000000000000f100a",
+			BackingCoinAddress: "0x4200000000000000000000000000000000000006",
+			PoolAddress:        "0x00000000000000000000000000000000000000000000000000000000000f1009",
+			PoolType:           schemas.PoolTypeLaunch,
+			Hooks:              "0x00000000000000000000000000000000000028cc",
+			HookFlags:          0x28cc,
+			HookRisk:           schemas.HookRiskHigh,
+			Launchpad:          "Clanker",
+			Creator:            "0x00000000000000000000000000000000000000aa",
+			InitialSupply:      "100000000000000000000000000000",
+			TokenName:          "Fixture",
+			TokenSymbol:        "FIX",
+		},
+	},
+	{
+		// the pool key hash is checked against the key like a V4 pool ID, the
+		// supply is read from the coin
+		name:    "Zora coin paired with ZORA (built)",
+		chainID: 8453,
+		log:     `{"address":"0x777777751622c0d3258f214f9df38e35bf45baf3","topics":["0x2de436107c2096e039c98bbcc3c5a2560583738ce15c234557eecb4d3221aa81","0x00000000000000000000000000000000000000000000000000000000000000aa","0x00000000000000000000000000000000000000000000000000000000000000aa","0x0000000000000000000000000000000000000000000000000000000000000000"],"data":"0x0000000000000000000000001111111111166b7fe7bd91427724b487980afc69000000000000000000000000000000000000000000000000000000000000018000000000000000000000000000000000000000000000000000000000000001c0000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000f100b00000000000000000000000000000000000000000000000000000000000f100b0000000000000000000000001111111111166b7fe7bd91427724b487980afc69000000000000000000000000000000000000000000000000000000000000271000000000000000000000000000000000000000000000000000000000000000c80000000000000000000000000000000000000000000000000000000000001040bfccbf6c939d5a284e9c884ecd2dd9f179768151d6b14934513240f519329b2d0000000000000000000000000000000000000000000000000000000000000240000000000000000000000000000000000000000000000000000000000000000e697066733a2f2f66697874757265000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000746697874757265000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000003464958000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000013400000000000000000000000000000000000000000000000000000000000000","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "Zora",
+			Address:            "0x00000000000000000000000000000000000f100b",
+			BackingCoinAddress: "0x1111111111166b7FE7bd91427724B487980aFc69",
+			PoolAddress:        "0xbfccbf6c939d5a284e9c884ecd2dd9f179768151d6b14934513240f519329b2d",
+			PoolType:           schemas.PoolTypeLaunch,
+			Currency0:          "0x00000000000000000000000000000000000f100b",
+			Currency1:          "0x1111111111166b7FE7bd91427724B487980aFc69",
+			Fee:                10000,
+			TickSpacing:        200,
+			Hooks:              "0x0000000000000000000000000000000000001040",
+			HookFlags:          0x1040,
+			HookRisk:           schemas.HookRiskHigh,
+			Launchpad:          "Zora",
+			Creator:            "0x00000000000000000000000000000000000000aa",
+			TokenName:          "Fixture",
+			TokenSymbol:        "FIX",
+		},
+	},
+	{
+		// tokens trade on the TokenManager's bonding curve against BNB
+		name:    "Four.meme token (built)",
+		chainID: 56,
+		log:     `{"address":"0x5c952063c7fc8610ffdb798152d69f0b9550762b","topics":["0x396d5e902b675b032348d3d2e9517ee8f0c4a926603fbc075d3d282ff00cad20"],"data":"0x00000000000000000000000000000000000000000000000000000000000000aa00000000000000000000000000000000000000000000000000000000000f100c0000000000000000000000000000000000000000000000000000000000000001000000000000000000000000000000000000000000000000000000000000010000000000000000000000000000000000000000000000000000000000000001400000000000000000000000000000000000000000033b2e3c9fd0803ce8000000000000000000000000000000000000000000000000000000000000006553f10000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000007466978747572650000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000034649580000000000000000000000000000000000000000000000000000000000","blockNumber":"0x0","transactionHash":"0x0000000000000000000000000000000000000000000000000000000000000000","transactionIndex":"0x0","blockHash":"0x0000000000000000000000000000000000000000000000000000000000000000","logIndex":"0x0","removed":false}`,
+		want: schemas.Contract{
+			Exchange:           "FourMeme",
+			Address:            "0x00000000000000000000000000000000000f100c",
+			BackingCoinAddress: "0x0000000000000000000000000000000000000000",
+			PoolAddress:        "0x5c952063c7fc8610FFDB798152D69F0B9550762b",
+			PoolType:           schemas.PoolTypeLaunch,
+			Launchpad:          "FourMeme",
+			Creator:            "0x00000000000000000000000000000000000000aa",
+			InitialSupply:      "1000000000000000000000000000",
+			TokenName:          "Fixture",
+			TokenSymbol:        "FIX",
+		},
+	},
+}
+
+// registered lists the exchanges and launchpads deployed on the chain.
+func registered(chainID uint64) []*schemas.Exchange {
+	exchanges := ForChain(chainID)
+	for _, launchpad := range LaunchpadsForChain(chainID) {
+		exchanges = append(exchanges, launchpad.Exchange())
+	}
+	return exchanges
+}
+
+// TestFixtures decodes every fixture the way a listener would: by the
+// exchange whose factory emitted the log and whose event it is.
+func TestFixtures(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			var vLog types.Log
+			if err := json.Unmarshal([]byte(f.log), &vLog); err != nil {
+				t.Fatalf("invalid log: %v", err)
+			}
+
+			var exchange *schemas.Exchange
+			var contractAbi abi.ABI
+			var eventName string
+			for _, e := range registered(f.chainID) {
+				if common.HexToAddress(e.Address) != vLog.Address {
+					continue
+				}
+				parsed, err := abi.JSON(strings.NewReader(e.ABI))
+				if err != nil {
+					t.Fatalf("invalid ABI of %s: %v", e.Name, err)
+				}
+				for name, event := range parsed.Events {
+					if len(vLog.Topics) > 0 && event.ID == vLog.Topics[0] {
+						exchange, contractAbi, eventName = e, parsed, name
+					}
+				}
+			}
+			if exchange == nil {
+				t.Fatalf("no exchange on chain %d emits this log", f.chainID)
+			}
+
+			c, err := exchange.Process(vLog, contractAbi, eventName)
+			if err != nil {
+				t.Fatalf("%s failed to decode the log: %v", exchange.Name, err)
+			}
+			c.ChainID = f.chainID
+			c.Orient(schemas.ChainByID(f.chainID))
+			c.SetLog(vLog, time.Time{})
+
+			// provenance comes from the log as eth_getLogs returned it
+			var raw map[string]any
+			if err := json.Unmarshal([]byte(f.log), &raw); err != nil {
+				t.Fatalf("invalid log: %v", err)
+			}
+			for _, field := range []struct {
+				name, key, got string
+			}{
+				{"block number", "blockNumber", hexutil.EncodeUint64(c.BlockNumber)},
+				{"block hash", "blockHash", c.BlockHash},
+				{"transaction", "transactionHash", c.TxHash},
+				{"log index", "logIndex", hexutil.EncodeUint64(uint64(c.LogIndex))},
+				{"factory", "address", c.Factory},
+			} {
+				want, _ := raw[field.key].(string)
+				if !strings.EqualFold(field.got, want) {
+					t.Errorf("%s is %s, the log says %q", field.name, field.got, want)
+				}
+			}
+			recorded := !strings.HasSuffix(f.name, "(rebuilt)") && !strings.HasSuffix(f.name, "(built)")
+			if recorded && (c.BlockNumber == 0 || common.HexToHash(c.TxHash) == (common.Hash{})) {
+				t.Errorf("recorded log carries no block or transaction")
+			}
+
+			switch {
+			case c.Currency0 != "":
+				if got := c.PoolKeyID(); got != common.HexToHash(c.PoolAddress) {
+					t.Errorf("pool ID %s does not match its PoolKey, which hashes to %s", c.PoolAddress, got.Hex())
+				}
+			case exchange.ComputePoolAddress != nil:
+				got := exchange.ComputePoolAddress(common.HexToAddress(c.Address), common.HexToAddress(c.BackingCoinAddress), c.Fee)
+				if got != common.HexToAddress(c.PoolAddress) {
+					t.Errorf("pool %s is not at its CREATE2 address %s", c.PoolAddress, got.Hex())
+				}
+			}
+
+			w := f.want
+			for _, field := range []struct {
+				name      string
+				got, want any
+			}{
+				{"exchange", c.Exchange, w.Exchange},
+				{"token", c.Address, w.Address},
+				{"quote", c.BackingCoinAddress, w.BackingCoinAddress},
+				{"pool", c.PoolAddress, w.PoolAddress},
+				{"pool type", c.PoolType, w.PoolType},
+				{"stable", c.Stable, w.Stable},
+				{"fee", c.Fee, w.Fee},
+				{"amplification", c.Amplification, w.Amplification},
+				{"tokens", poolTokensLabel(c.Tokens), poolTokensLabel(w.Tokens)},
+				{"tick spacing", c.TickSpacing, w.TickSpacing},
+				{"currency0", c.Currency0, w.Currency0},
+				{"currency1", c.Currency1, w.Currency1},
+				{"parameters", c.Parameters, w.Parameters},
+				{"bin step", c.BinStep, w.BinStep},
+				{"active ID", c.ActiveID, w.ActiveID},
+				{"hooks", c.Hooks, w.Hooks},
+				{"hook flags", c.HookFlags, w.HookFlags},
+				{"hook risk", c.HookRisk, w.HookRisk},
+				{"launchpad", c.Launchpad, w.Launchpad},
+				{"creator", c.Creator, w.Creator},
+				{"initial supply", c.InitialSupply, w.InitialSupply},
+				{"token name", c.TokenName, w.TokenName},
+				{"token symbol", c.TokenSymbol, w.TokenSymbol},
+			} {
+				// addresses and hashes are compared without their checksum case
+				if got, ok := field.got.(string); ok && strings.EqualFold(got, field.want.(string)) {
+					continue
+				}
+				if field.got != field.want {
+					t.Errorf("%s is %v, expected %v", field.name, field.got, field.want)
+				}
+			}
+		})
+	}
+}
+
+// TestFixturesCoverEveryExchange fails for every registered exchange or
+// launchpad no fixture decodes.
+func TestFixturesCoverEveryExchange(t *testing.T) {
+	covered := make(map[string]bool)
+	for _, f := range fixtures {
+		covered[f.want.Exchange] = true
+	}
+
+	for chainID := range schemas.Chains {
+		for _, e := range registered(chainID) {
+			if !covered[e.Name] {
+				covered[e.Name] = true
+				t.Errorf("no fixture for %s", e.Name)
+			}
+		}
+	}
+}
+
+// poolTokensLabel lists the tokens of a pool and their weights.
+func poolTokensLabel(tokens []schemas.PoolToken) string {
+	var labels []string
+	for _, t := range tokens {
+		label := strings.ToLower(t.Token)
+		if t.Weight != "" {
+			label += "@" + t.Weight
+		}
+		labels = append(labels, label)
+	}
+	return "[" + strings.Join(labels, " ") + "]"
+}
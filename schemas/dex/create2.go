@@ -0,0 +1,26 @@
+package dex
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"snipr/schemas"
+)
+
+// v2PoolAddress computes V2 pair addresses; fee is ignored as a pair has none.
+func v2PoolAddress(factory, initCodeHash string) func(tokenA, tokenB common.Address, fee uint32) common.Address {
+	factoryAddress := common.HexToAddress(factory)
+	hash := common.HexToHash(initCodeHash)
+	return func(tokenA, tokenB common.Address, fee uint32) common.Address {
+		return schemas.V2PairAddress(factoryAddress, tokenA, tokenB, hash)
+	}
+}
+
+// v3PoolAddress computes V3 pool addresses. deployer is the factory itself
+// unless the exchange splits deployment off, like PancakeSwap V3.
+func v3PoolAddress(deployer, initCodeHash string) func(tokenA, tokenB common.Address, fee uint32) common.Address {
+	deployerAddress := common.HexToAddress(deployer)
+	hash := common.HexToHash(initCodeHash)
+	return func(tokenA, tokenB common.Address, fee uint32) common.Address {
+		return schemas.V3PoolAddress(deployerAddress, tokenA, tokenB, fee, hash)
+	}
+}
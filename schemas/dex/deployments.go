@@ -0,0 +1,199 @@
+package dex
+
+import (
+	"snipr/schemas"
+)
+
+// Deployment is where an exchange's contracts live on one chain.
+type Deployment struct {
+	ChainID    uint64
+	Factory    string // the pool manager on V4
+	StartBlock uint64 // block the factory was deployed in, 0 if not known
+
+	// Router whose calls create pools, the position manager on V4. Pending
+	// pools are only decoded when it is set.
+	Router string
+}
+
+// Block numbers left at 0 are not known yet. A backfill starts at the
+// earliest known block of a chain's factories and is refused on chains where
+// none is known.
+var UniswapV2Deployments = []Deployment{
+	{ChainID: 1, Factory: "0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f", StartBlock: 10000835, Router: "0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D"},
+	{ChainID: 10, Factory: "0x0c3c1c532F1e39EdF36BE9Fe0bE1410313E074Bf", Router: "0x4A7b5Da61326A6379179b40d00F57E5bbDC962c2"},
+	{ChainID: 56, Factory: "0x8909Dc15e40173Ff4699343b6eB8132c65e18eC6", Router: "0x4752ba5DBc23f44D87826276BF6Fd6b1C372aD24"},
+	{ChainID: 137, Factory: "0x9e5A52f57b3038F1B8EeE45F28b3C1967e22799C", Router: "0xedf6066a2b290C185783862C7F4776A2C8077AD1"},
+	{ChainID: 8453, Factory: "0x8909Dc15e40173Ff4699343b6eB8132c65e18eC6", Router: "0x4752ba5DBc23f44D87826276BF6Fd6b1C372aD24"},
+	{ChainID: 42161, Factory: "0xf1D7CC64Fb4452F05c498126312eBE29f30Fbcf9", Router: "0x4752ba5DBc23f44D87826276BF6Fd6b1C372aD24"},
+}
+
+var UniswapV3Deployments = []Deployment{
+	{ChainID: 1, Factory: "0x1F98431c8aD98523631AE4a59f267346ea31F984", StartBlock: 12369621},
+	{ChainID: 10, Factory: "0x1F98431c8aD98523631AE4a59f267346ea31F984"},
+	{ChainID: 56, Factory: "0xdB1d10011AD0Ff90774D0C6Bb92e5C5c8b4461F7"},
+	{ChainID: 137, Factory: "0x1F98431c8aD98523631AE4a59f267346ea31F984"},
+	{ChainID: 8453, Factory: "0x33128a8fC17869897dcE68Ed026d694621f6FDfD"},
+	{ChainID: 42161, Factory: "0x1F98431c8aD98523631AE4a59f267346ea31F984"},
+}
+
+var UniswapV4Deployments = []Deployment{
+	{ChainID: 1, Factory: "0x000000000004444c5dc75cB358380D2e3dE08A90", StartBlock: 21688329, Router: "0xbD216513d74C8cf14cf4747E6AaA6420FF64ee9e"},
+	{ChainID: 10, Factory: "0x9a13F98Cb987694C9F086b1F5eB990EeA8264Ec3", Router: "0x3C3Ea4B57a46241e54610e5f022E5c45859A1017"},
+	{ChainID: 56, Factory: "0x28e2Ea090877bF75740558f6BFB36A5ffeE9e9dF", Router: "0x7A4a5c919aE2541AeD11041A1AEeE68f1287f95b"},
+	{ChainID: 137, Factory: "0x67366782805870060151383F4BbFF9daB53e5cD6", Router: "0x1Ec2eBf4F37E7363FDfe3551602425af0B3ceef9"},
+	{ChainID: 8453, Factory: "0x498581fF718922c3f8e6A244956aF099B2652b2b", Router: "0x7C5f5A4bBd8fD63184577525326123B519429bDc"},
+	{ChainID: 42161, Factory: "0x360E68faCcca8cA495c1B759Fd9EEe466db9FB32", Router: "0xd88F38F930b7952f2DB2432Cb002E7abbF3dD869"},
+}
+
+var PancakeSwapV2Deployments = []Deployment{
+	{ChainID: 56, Factory: "0xcA143Ce32Fe78f1f7019d7d551a6402fC5350c73", StartBlock: 6809737, Router: "0x10ED43C718714eb63d5aA57B78B54704E256024E"},
+}
+
+// PancakeSwap V3 deploys its factory and pool deployer at the same addresses
+// on every chain.
+var PancakeSwapV3Deployments = []Deployment{
+	{ChainID: 1, Factory: "0x0BFbCF9fa4f9C56B0F40a671Ad40E0805A091865"},
+	{ChainID: 56, Factory: "0x0BFbCF9fa4f9C56B0F40a671Ad40E0805A091865", StartBlock: 26956207},
+	{ChainID: 8453, Factory: "0x0BFbCF9fa4f9C56B0F40a671Ad40E0805A091865"},
+	{ChainID: 42161, Factory: "0x0BFbCF9fa4f9C56B0F40a671Ad40E0805A091865"},
+}
+
+// PancakeSwap Infinity pool managers. Pending pools are not decoded, so no
+// position managers are listed.
+var PancakeSwapInfinityCLDeployments = []Deployment{
+	{ChainID: 56, Factory: "0xa0FfB9c1CE1Fe56963B0321B32E7A0302114058b"},
+}
+
+var PancakeSwapInfinityBinDeployments = []Deployment{
+	{ChainID: 56, Factory: "0xC697d2898e0D09264376196696c51D7aBbbAA4a9"},
+}
+
+// Solidly forks. Aerodrome and Velodrome V2 share the pool factory contract,
+// Thena runs the original Solidly pair factory.
+var AerodromeDeployments = []Deployment{
+	{ChainID: 8453, Factory: "0x420DD381b31aEf6683db6B902084cB0FFECe40Da"},
+}
+
+var AerodromeSlipstreamDeployments = []Deployment{
+	{ChainID: 8453, Factory: "0x5e7BB104d84c7CB9B682AaC2F3d509f5F406809A"},
+}
+
+var VelodromeDeployments = []Deployment{
+	{ChainID: 10, Factory: "0xF1046053aa5682b4F9a81b5481394DA16BE5FF5a"},
+}
+
+var ThenaDeployments = []Deployment{
+	{ChainID: 56, Factory: "0xAFD89d21BdB66d00817d4153E055830B1c2B3970"},
+}
+
+// The Balancer V2 Vault has the same address on every chain.
+var BalancerV2Deployments = []Deployment{
+	{ChainID: 1, Factory: "0xBA12222222228d8Ba445958a75a0704d566BF2C8", StartBlock: 12272146},
+	{ChainID: 10, Factory: "0xBA12222222228d8Ba445958a75a0704d566BF2C8"},
+	{ChainID: 137, Factory: "0xBA12222222228d8Ba445958a75a0704d566BF2C8"},
+	{ChainID: 8453, Factory: "0xBA12222222228d8Ba445958a75a0704d566BF2C8"},
+	{ChainID: 42161, Factory: "0xBA12222222228d8Ba445958a75a0704d566BF2C8"},
+}
+
+// Curve NG factories. Plain and meta pools come from the same StableSwap
+// factory under different events.
+var CurveStableSwapNGDeployments = []Deployment{
+	{ChainID: 1, Factory: "0x6A8cbed756804B16E05E741eDaBd5cB544AE21bf"},
+	{ChainID: 8453, Factory: "0xd2002373543Ce3527023C75e7518C274A51ce712"},
+	{ChainID: 42161, Factory: "0x9AF14D26075f142eb3F292D5065EB3faa646167b"},
+}
+
+var CurveTwocryptoNGDeployments = []Deployment{
+	{ChainID: 1, Factory: "0x98EE851a00abeE0d95D08cF4CA2BdCE32aeaAF7F"},
+	{ChainID: 10, Factory: "0x98EE851a00abeE0d95D08cF4CA2BdCE32aeaAF7F"},
+	{ChainID: 8453, Factory: "0x98EE851a00abeE0d95D08cF4CA2BdCE32aeaAF7F"},
+	{ChainID: 42161, Factory: "0x98EE851a00abeE0d95D08cF4CA2BdCE32aeaAF7F"},
+}
+
+var CurveTricryptoNGDeployments = []Deployment{
+	{ChainID: 1, Factory: "0x0c0e5f2fF0ff18a3be9b835635039256dC4B4963"},
+}
+
+// Trader Joe Liquidity Book factories. V2.1 and V2.2 pairs are swapped
+// through different routers, so each version is an exchange of its own.
+var TraderJoeLBV21Deployments = []Deployment{
+	{ChainID: 1, Factory: "0x8e42f2F4101563bF679975178e880FD87d3eFd4e"},
+	{ChainID: 56, Factory: "0x8e42f2F4101563bF679975178e880FD87d3eFd4e"},
+	{ChainID: 42161, Factory: "0x8e42f2F4101563bF679975178e880FD87d3eFd4e"},
+	{ChainID: 43114, Factory: "0x8e42f2F4101563bF679975178e880FD87d3eFd4e"},
+}
+
+var TraderJoeLBV22Deployments = []Deployment{
+	{ChainID: 56, Factory: "0xb43120c4745967fa9b93E79C149E66B0f2D6Fe0c"},
+	{ChainID: 42161, Factory: "0xb43120c4745967fa9b93E79C149E66B0f2D6Fe0c"},
+	{ChainID: 43114, Factory: "0xb43120c4745967fa9b93E79C149E66B0f2D6Fe0c"},
+}
+
+// ForChain returns every exchange snipr knows a deployment of on chainID.
+func ForChain(chainID uint64) []*schemas.Exchange {
+	var exchanges []*schemas.Exchange
+	for _, table := range []struct {
+		deployments []Deployment
+		exchange    func(d Deployment) *schemas.Exchange
+	}{
+		{UniswapV2Deployments, UniswapV2},
+		{UniswapV3Deployments, UniswapV3},
+		{UniswapV4Deployments, UniswapV4},
+		{PancakeSwapV2Deployments, PancakeSwapV2},
+		{PancakeSwapV3Deployments, PancakeSwapV3},
+		{PancakeSwapInfinityCLDeployments, PancakeSwapInfinityCL},
+		{PancakeSwapInfinityBinDeployments, PancakeSwapInfinityBin},
+		{AerodromeDeployments, Aerodrome},
+		{AerodromeSlipstreamDeployments, AerodromeSlipstream},
+		{VelodromeDeployments, Velodrome},
+		{ThenaDeployments, Thena},
+		{BalancerV2Deployments, BalancerV2},
+		{CurveStableSwapNGDeployments, CurveStableSwapNG},
+		{CurveStableSwapNGDeployments, CurveStableSwapNGMeta},
+		{CurveTwocryptoNGDeployments, CurveTwocryptoNG},
+		{CurveTricryptoNGDeployments, CurveTricryptoNG},
+		{TraderJoeLBV21Deployments, TraderJoeLBV21},
+		{TraderJoeLBV22Deployments, TraderJoeLBV22},
+	} {
+		for _, d := range table.deployments {
+			if d.ChainID == chainID {
+				exchanges = append(exchanges, table.exchange(d))
+			}
+		}
+	}
+	return exchanges
+}
+
+// Launchpads, listened for next to the exchanges
+var ClankerDeployments = []Deployment{
+	{ChainID: 8453, Factory: "0xE85A59c628F7d27878ACeB4bf3b35733630083a9"},
+}
+
+var ZoraDeployments = []Deployment{
+	{ChainID: 8453, Factory: "0x777777751622c0d3258f214F9DF38E35BF45baF3"},
+}
+
+var FourMemeDeployments = []Deployment{
+	{ChainID: 56, Factory: "0x5c952063c7fc8610FFDB798152D69F0B9550762b"},
+}
+
+// LaunchpadsForChain returns every launchpad snipr knows a deployment of on
+// chainID.
+func LaunchpadsForChain(chainID uint64) []*schemas.Launchpad {
+	var launchpads []*schemas.Launchpad
+	for _, table := range []struct {
+		deployments []Deployment
+		launchpad   func(d Deployment) *schemas.Launchpad
+	}{
+		{ClankerDeployments, Clanker},
+		{ZoraDeployments, Zora},
+		{FourMemeDeployments, FourMeme},
+	} {
+		for _, d := range table.deployments {
+			if d.ChainID == chainID {
+				launchpads = append(launchpads, table.launchpad(d))
+			}
+		}
+	}
+	return launchpads
+}
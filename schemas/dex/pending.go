@@ -0,0 +1,283 @@
+package dex
+
+import (
+	"encoding/binary"
+	"log"
+	"math/big"
+	"strings"
+
+	"snipr/schemas"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Calls that create pools, as far as they can be decoded from a pending
+// transaction before the factory emits anything.
+const pendingABI = `[
+	{"name":"createPair","type":"function","inputs":[{"name":"tokenA","type":"address"},{"name":"tokenB","type":"address"}]},
+	{"name":"addLiquidityETH","type":"function","inputs":[{"name":"token","type":"address"},{"name":"amountTokenDesired","type":"uint256"},{"name":"amountTokenMin","type":"uint256"},{"name":"amountETHMin","type":"uint256"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}]},
+	{"name":"createPool","type":"function","inputs":[{"name":"tokenA","type":"address"},{"name":"tokenB","type":"address"},{"name":"fee","type":"uint24"}]},
+	{"name":"initialize","type":"function","inputs":[{"name":"key","type":"tuple","components":[{"name":"currency0","type":"address"},{"name":"currency1","type":"address"},{"name":"fee","type":"uint24"},{"name":"tickSpacing","type":"int24"},{"name":"hooks","type":"address"}]},{"name":"sqrtPriceX96","type":"uint160"}]},
+	{"name":"initializePool","type":"function","inputs":[{"name":"key","type":"tuple","components":[{"name":"currency0","type":"address"},{"name":"currency1","type":"address"},{"name":"fee","type":"uint24"},{"name":"tickSpacing","type":"int24"},{"name":"hooks","type":"address"}]},{"name":"sqrtPriceX96","type":"uint160"}]},
+	{"name":"modifyLiquidities","type":"function","inputs":[{"name":"unlockData","type":"bytes"},{"name":"deadline","type":"uint256"}]},
+	{"name":"multicall","type":"function","inputs":[{"name":"data","type":"bytes[]"}]}
+]`
+
+var pendingMethods = mustParseABI(pendingABI)
+
+// V4 position manager actions that add liquidity to a pool key
+const (
+	v4MintPosition           = 0x02
+	v4MintPositionFromDeltas = 0x05
+)
+
+type poolKey struct {
+	Currency0   common.Address
+	Currency1   common.Address
+	Fee         *big.Int
+	TickSpacing *big.Int
+	Hooks       common.Address
+}
+
+func (k poolKey) id() common.Hash {
+	return schemas.V4PoolID(k.Currency0, k.Currency1, uint32(k.Fee.Uint64()), int32(k.TickSpacing.Int64()), k.Hooks)
+}
+
+func mustParseABI(s string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(s))
+	if err != nil {
+		log.Fatalf("Failed to parse ABI: %v", err)
+	}
+	return parsed
+}
+
+// decodeCall returns the method input calls and its arguments, nil if input
+// is not a call to one of names.
+func decodeCall(input []byte, names ...string) (*abi.Method, []any) {
+	if len(input) < 4 {
+		return nil, nil
+	}
+	method, err := pendingMethods.MethodById(input[:4])
+	if err != nil {
+		return nil, nil
+	}
+	for _, name := range names {
+		if method.Name != name {
+			continue
+		}
+		args, err := method.Inputs.Unpack(input[4:])
+		if err != nil {
+			return nil, nil
+		}
+		return method, args
+	}
+	return nil, nil
+}
+
+// v2Pending decodes createPair on a V2 factory and addLiquidityETH on its
+// router, which creates the pair if it does not exist yet.
+func v2Pending(exchange, factory, router, wrappedNative string, poolAddress func(tokenA, tokenB common.Address, fee uint32) common.Address) func(tx *types.Transaction) []*schemas.PendingPool {
+	factoryAddress := common.HexToAddress(factory)
+	routerAddress := common.HexToAddress(router)
+	weth := common.HexToAddress(wrappedNative)
+
+	pending := func(method string, tokenA, tokenB common.Address) []*schemas.PendingPool {
+		token0, token1 := schemas.SortTokens(tokenA, tokenB)
+		return []*schemas.PendingPool{{
+			Exchange:    exchange,
+			Method:      method,
+			Token0:      token0.Hex(),
+			Token1:      token1.Hex(),
+			PoolAddress: poolAddress(token0, token1, 0).Hex(),
+		}}
+	}
+
+	return func(tx *types.Transaction) []*schemas.PendingPool {
+		switch {
+		case tx.To() == nil:
+			return nil
+
+		case *tx.To() == factoryAddress:
+			if method, args := decodeCall(tx.Data(), "createPair"); method != nil {
+				return pending(method.Name, args[0].(common.Address), args[1].(common.Address))
+			}
+
+		case router != "" && *tx.To() == routerAddress:
+			if method, args := decodeCall(tx.Data(), "addLiquidityETH"); method != nil {
+				return pending(method.Name, args[0].(common.Address), weth)
+			}
+		}
+		return nil
+	}
+}
+
+// v3Pending decodes createPool on a V3 factory.
+func v3Pending(exchange, factory string, poolAddress func(tokenA, tokenB common.Address, fee uint32) common.Address) func(tx *types.Transaction) []*schemas.PendingPool {
+	factoryAddress := common.HexToAddress(factory)
+
+	return func(tx *types.Transaction) []*schemas.PendingPool {
+		if tx.To() == nil || *tx.To() != factoryAddress {
+			return nil
+		}
+		method, args := decodeCall(tx.Data(), "createPool")
+		if method == nil {
+			return nil
+		}
+
+		token0, token1 := schemas.SortTokens(args[0].(common.Address), args[1].(common.Address))
+		fee := uint32(args[2].(*big.Int).Uint64())
+		return []*schemas.PendingPool{{
+			Exchange:    exchange,
+			Method:      method.Name,
+			Token0:      token0.Hex(),
+			Token1:      token1.Hex(),
+			Fee:         fee,
+			PoolAddress: poolAddress(token0, token1, fee).Hex(),
+		}}
+	}
+}
+
+// v4Pending decodes initialize on the pool manager and initializePool and
+// liquidity mints on the position manager, including ones batched through its
+// multicall. V4 pools have no address, they are identified by pool ID. A pool
+// has to be initialized before liquidity is minted into it, so mints are only
+// reported when the same call initializes their pool; the rest add to pools
+// that already exist.
+func v4Pending(exchange, poolManager, positionManager string) func(tx *types.Transaction) []*schemas.PendingPool {
+	managerAddress := common.HexToAddress(poolManager)
+	positionsAddress := common.HexToAddress(positionManager)
+
+	pending := func(method string, key poolKey) *schemas.PendingPool {
+		return &schemas.PendingPool{
+			Exchange:    exchange,
+			Method:      method,
+			Token0:      key.Currency0.Hex(),
+			Token1:      key.Currency1.Hex(),
+			Fee:         uint32(key.Fee.Uint64()),
+			PoolAddress: key.id().Hex(),
+		}
+	}
+
+	var decodePositions func(input []byte, depth int) []*schemas.PendingPool
+	decodePositions = func(input []byte, depth int) []*schemas.PendingPool {
+		method, args := decodeCall(input, "initializePool", "modifyLiquidities", "multicall")
+		if method == nil {
+			return nil
+		}
+
+		switch method.Name {
+		case "initializePool":
+			key := abi.ConvertType(args[0], new(poolKey)).(*poolKey)
+			return []*schemas.PendingPool{pending(method.Name, *key)}
+
+		case "modifyLiquidities":
+			var pools []*schemas.PendingPool
+			for _, key := range decodeMints(args[0].([]byte)) {
+				pools = append(pools, pending(method.Name, key))
+			}
+			return pools
+
+		default: // multicall
+			if depth > 0 {
+				return nil
+			}
+			var pools []*schemas.PendingPool
+			for _, call := range args[0].([][]byte) {
+				pools = append(pools, decodePositions(call, depth+1)...)
+			}
+			return pools
+		}
+	}
+
+	return func(tx *types.Transaction) []*schemas.PendingPool {
+		switch {
+		case tx.To() == nil:
+			return nil
+
+		case *tx.To() == managerAddress:
+			if method, args := decodeCall(tx.Data(), "initialize"); method != nil {
+				key := abi.ConvertType(args[0], new(poolKey)).(*poolKey)
+				return []*schemas.PendingPool{pending(method.Name, *key)}
+			}
+
+		case positionManager != "" && *tx.To() == positionsAddress:
+			return dedupePending(initializedPending(decodePositions(tx.Data(), 0)))
+		}
+		return nil
+	}
+}
+
+// decodeMints returns the pool keys minted into by modifyLiquidities
+// unlockData, abi.encode(bytes actions, bytes[] params). The pool key is the
+// static tuple at the start of a mint's params.
+func decodeMints(unlockData []byte) []poolKey {
+	bytesType, _ := abi.NewType("bytes", "", nil)
+	bytesArrayType, _ := abi.NewType("bytes[]", "", nil)
+	args, err := abi.Arguments{{Type: bytesType}, {Type: bytesArrayType}}.Unpack(unlockData)
+	if err != nil {
+		return nil
+	}
+
+	actions := args[0].([]byte)
+	params := args[1].([][]byte)
+
+	var keys []poolKey
+	for i, action := range actions {
+		if action != v4MintPosition && action != v4MintPositionFromDeltas {
+			continue
+		}
+		if i >= len(params) || len(params[i]) < 5*32 {
+			continue
+		}
+
+		p := params[i]
+		keys = append(keys, poolKey{
+			Currency0:   common.BytesToAddress(p[12:32]),
+			Currency1:   common.BytesToAddress(p[44:64]),
+			Fee:         new(big.Int).SetBytes(p[64:96]),
+			TickSpacing: big.NewInt(int64(int32(binary.BigEndian.Uint32(p[124:128])))),
+			Hooks:       common.BytesToAddress(p[140:160]),
+		})
+	}
+	return keys
+}
+
+// initializedPending drops the mints into pools that are not initialized in
+// the same call.
+func initializedPending(pools []*schemas.PendingPool) []*schemas.PendingPool {
+	initialized := make(map[string]bool)
+	for _, p := range pools {
+		if p.Method == "initializePool" {
+			initialized[p.PoolAddress] = true
+		}
+	}
+
+	var out []*schemas.PendingPool
+	for _, p := range pools {
+		if initialized[p.PoolAddress] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// dedupePending drops repeats of a pool, e.g. initializePool followed by a
+// mint into the same pool in one multicall.
+func dedupePending(pools []*schemas.PendingPool) []*schemas.PendingPool {
+	var out []*schemas.PendingPool
+	for _, p := range pools {
+		dup := false
+		for _, o := range out {
+			if o.PoolAddress == p.PoolAddress {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			out = append(out, p)
+		}
+	}
+	return out
+}
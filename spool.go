@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"snipr/schemas"
+)
+
+const spoolSegmentBytes = 8 << 20
+
+var errSpoolFull = errors.New("spool is full")
+
+var (
+	metricSpoolBytes    = expvar.NewMap("spool_bytes")
+	metricSpoolSpooled  = expvar.NewMap("spool_spooled")
+	metricSpoolReplayed = expvar.NewMap("spool_replayed")
+	metricSpoolDropped  = expvar.NewMap("spool_dropped")
+)
+
+// spool is an append-only log of contracts a backend could not accept. Records
+// are kept in numbered JSON-lines segments and replayed oldest first, so once
+// anything is spooled every later batch for that backend goes through the spool
+// as well to keep the original order.
+//
+// Replay is at-least-once: a segment is only deleted once all of it was
+// delivered, which is fine because writes to every backend are idempotent.
+type spool struct {
+	name     string
+	dir      string
+	maxBytes int64
+
+	mu          sync.Mutex
+	size        int64    // bytes across all segments
+	segments    []string // oldest first
+	current     *os.File
+	currentSize int64
+	seq         uint64
+	offset      int // records of the oldest segment already delivered
+}
+
+func openSpool(dir, name string, maxBytes int64) (*spool, error) {
+	dir = filepath.Join(dir, name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &spool{name: name, dir: dir, maxBytes: maxBytes}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".jsonl") {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		var seq uint64
+		if _, err := fmt.Sscanf(e.Name(), "%020d.jsonl", &seq); err != nil {
+			continue
+		}
+		if seq >= s.seq {
+			s.seq = seq + 1
+		}
+
+		s.segments = append(s.segments, e.Name())
+		s.size += info.Size()
+	}
+	sort.Strings(s.segments)
+	metricSpoolBytes.Set(name, expvarInt(s.size))
+
+	if len(s.segments) > 0 {
+		log.Printf("Spool %s has %d bytes pending from a previous run", name, s.size)
+	}
+
+	return s, nil
+}
+
+// pending reports whether anything is waiting to be replayed.
+func (s *spool) pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.segments) > 0
+}
+
+// append durably stores a batch at the end of the spool.
+func (s *spool) append(batch []*schemas.Contract) error {
+	var buf []byte
+	for _, c := range batch {
+		line, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxBytes > 0 && s.size+int64(len(buf)) > s.maxBytes {
+		metricSpoolDropped.Add(s.name, int64(len(batch)))
+		return errSpoolFull
+	}
+
+	if s.current == nil || s.currentSize >= spoolSegmentBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.current.Write(buf); err != nil {
+		return err
+	}
+	if err := s.current.Sync(); err != nil {
+		return err
+	}
+
+	s.currentSize += int64(len(buf))
+	s.size += int64(len(buf))
+	metricSpoolBytes.Set(s.name, expvarInt(s.size))
+	metricSpoolSpooled.Add(s.name, int64(len(batch)))
+
+	return nil
+}
+
+// rotate starts a new segment. Callers hold s.mu.
+func (s *spool) rotate() error {
+	if s.current != nil {
+		s.current.Close()
+		s.current = nil
+	}
+
+	name := fmt.Sprintf("%020d.jsonl", s.seq)
+	f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	s.seq++
+	s.current = f
+	s.currentSize = 0
+	s.segments = append(s.segments, name)
+
+	return nil
+}
+
+// replay delivers spooled records oldest first until the spool is empty or
+// the backend fails again.
+func (s *spool) replay(batchSize int, deliver func([]*schemas.Contract) error) error {
+	for {
+		s.mu.Lock()
+		if len(s.segments) == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+
+		// never read the segment that is still being appended to
+		if len(s.segments) == 1 && s.current != nil {
+			s.current.Close()
+			s.current = nil
+		}
+
+		name := s.segments[0]
+		offset := s.offset
+		s.mu.Unlock()
+
+		path := filepath.Join(s.dir, name)
+		records, err := readSpoolSegment(path)
+		if err != nil {
+			return err
+		}
+
+		for offset < len(records) {
+			end := min(offset+batchSize, len(records))
+			if err := deliver(records[offset:end]); err != nil {
+				return err
+			}
+
+			metricSpoolReplayed.Add(s.name, int64(end-offset))
+			offset = end
+
+			s.mu.Lock()
+			s.offset = offset
+			s.mu.Unlock()
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.segments = s.segments[1:]
+		s.offset = 0
+		s.size -= info.Size()
+		metricSpoolBytes.Set(s.name, expvarInt(s.size))
+		s.mu.Unlock()
+
+		log.Printf("Replayed %d spooled contracts to %s", len(records), s.name)
+	}
+}
+
+// replayLoop retries the spool in the background until quit is closed.
+func (s *spool) replayLoop(interval time.Duration, batchSize int, deliver func([]*schemas.Contract) error, quit <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			if !s.pending() {
+				continue
+			}
+			if err := s.replay(batchSize, deliver); err != nil {
+				log.Printf("Spool %s replay stopped: %v", s.name, err)
+			}
+		}
+	}
+}
+
+func readSpoolSegment(path string) ([]*schemas.Contract, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []*schemas.Contract
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var c schemas.Contract
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			// a torn write from a crash can only be the last line
+			log.Printf("Skipping unreadable record in %s: %v", path, err)
+			continue
+		}
+		records = append(records, &c)
+	}
+
+	return records, scanner.Err()
+}
+
+func expvarInt(v int64) *expvar.Int {
+	i := new(expvar.Int)
+	i.Set(v)
+	return i
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"snipr/schemas"
+	"snipr/schemas/dex"
+)
+
+// Pool view selectors, shared by V2 pairs and V3 pools
+var (
+	selectorToken0  = common.FromHex("0x0dfe1681")
+	selectorToken1  = common.FromHex("0xd21220a7")
+	selectorFee     = common.FromHex("0xddca3f43")
+	selectorFactory = common.FromHex("0xc45a0155")
+)
+
+var metricCreate2Mismatch = expvar.NewMap("pools_create2_mismatch") // by exchange
+
+// verifyPoolAddress flags c when its pool is not where the exchange's factory
+// deploys the pool of its tokens, which no genuine factory event can produce.
+// V4 pools are checked against the hash of their PoolKey instead. Other
+// exchanges without CREATE2 pool contracts are not checked.
+func verifyPoolAddress(exchange *schemas.Exchange, c *schemas.Contract) {
+	if c.Currency0 != "" {
+		verifyPoolKey(exchange, c)
+		return
+	}
+	if exchange.ComputePoolAddress == nil || !common.IsHexAddress(c.PoolAddress) {
+		return
+	}
+
+	expected := exchange.ComputePoolAddress(common.HexToAddress(c.Address), common.HexToAddress(c.BackingCoinAddress), c.Fee)
+	if expected == common.HexToAddress(c.PoolAddress) {
+		return
+	}
+
+	c.Create2Mismatch = true
+	metricCreate2Mismatch.Add(exchange.Name, 1)
+	log.Printf("Warning: %s pool %s for %s/%s is not at its CREATE2 address %s (tx %s)",
+		exchange.Name, c.PoolAddress, c.Address, c.BackingCoinAddress, expected.Hex(), c.TxHash)
+}
+
+func verifyPoolKey(exchange *schemas.Exchange, c *schemas.Contract) {
+	expected := c.PoolKeyID()
+	if expected == common.HexToHash(c.PoolAddress) {
+		return
+	}
+
+	c.Create2Mismatch = true
+	metricCreate2Mismatch.Add(exchange.Name, 1)
+	log.Printf("Warning: %s pool ID %s does not match its PoolKey %s/%s fee %d tick spacing %d hooks %s, which hashes to %s (tx %s)",
+		exchange.Name, c.PoolAddress, c.Currency0, c.Currency1, c.Fee, c.TickSpacing, c.Hooks, expected.Hex(), c.TxHash)
+}
+
+// runVerify reads a pool's tokens and fee from the chain and checks which
+// monitored factory, if any, deployed it. Pools that match none were created
+// some other way, e.g. a copy of the pool contract deployed directly.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snipr verify <pool address>")
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || !common.IsHexAddress(fs.Arg(0)) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	pool := common.HexToAddress(fs.Arg(0))
+
+	gateway := auth()
+	calls := newCallBatcher(gateway, priorityLive, *multicallWindow, *multicallMaxCalls, *multicallAddress)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	results := calls.CallMany(ctx, []callRequest{
+		{To: pool, Data: selectorToken0},
+		{To: pool, Data: selectorToken1},
+		{To: pool, Data: selectorFee},
+		{To: pool, Data: selectorFactory},
+	})
+	for _, r := range results[:2] {
+		if r.Err != nil || len(r.Data) < 32 {
+			log.Fatalf("%s does not look like a V2 or V3 pool: token0/token1 unreadable", pool.Hex())
+		}
+	}
+
+	token0 := common.BytesToAddress(results[0].Data[:32])
+	token1 := common.BytesToAddress(results[1].Data[:32])
+	var fee uint32
+	if r := results[2]; r.Err == nil && len(r.Data) >= 32 {
+		fee = uint32(new(big.Int).SetBytes(r.Data[:32]).Uint64())
+	}
+
+	fmt.Printf("Pool:    %s\nToken0:  %s\nToken1:  %s\nFee:     %d\n", pool.Hex(), token0.Hex(), token1.Hex(), fee)
+	if r := results[3]; r.Err == nil && len(r.Data) >= 32 {
+		fmt.Printf("Claims factory %s\n", common.BytesToAddress(r.Data[:32]).Hex())
+	}
+
+	for _, exchange := range dex.ForChain(gateway.ChainID().Uint64()) {
+		if exchange.ComputePoolAddress == nil {
+			continue
+		}
+		if exchange.ComputePoolAddress(token0, token1, fee) == pool {
+			fmt.Printf("Deployed by the %s factory %s\n", exchange.Name, exchange.Address)
+			return
+		}
+	}
+
+	fmt.Println("Not deployed by any monitored factory")
+	os.Exit(1)
+}